@@ -21,6 +21,14 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+const (
+	// LabelReviewApp is the label of a PR for the name of its parent ReviewApp.
+	// A name longer than the limit of a label value is shortened with a hash. See also PRSpec.ParentReviewApp for the exact value.
+	LabelReviewApp = "kubetempura.mercari.com/reviewapp"
+	// LabelPRNumber is the label of a PR for the number of the pull request.
+	LabelPRNumber = "kubetempura.mercari.com/pr-number"
+)
+
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
 // NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
 
@@ -37,19 +45,98 @@ type PRSpec struct {
 	// PR Number
 	PRNumber string `json:"prNumber"`
 
+	// +optional
+	// The host and the full name of the repository of the pull request. E.g. github.com/mercari/kubetempura
+	Repository string `json:"repository,omitempty"`
+
 	// +kubebuilder:validation:Required
 	// The sha of the latest commit.
 	HeadCommitRef string `json:"headCommitRef"`
 
+	// +optional
+	// The commit of a pull request from a fork which was approved by adding the approval label of the forkPolicy.
+	// The later commits aren't deployed until the label is added again.
+	ApprovedCommitRef string `json:"approvedCommitRef,omitempty"`
+
 	// +kubebuilder:pruning:PreserveUnknownFields
-	// Environment variables for adding / overriding the default values.
+	// Environment variables for adding / overriding the default values. They're read from the description of the pull request.
 	EnvVars []corev1.EnvVar `json:"envVars,omitempty"`
+
+	// +kubebuilder:pruning:PreserveUnknownFields
+	// +optional
+	// Environment variables overriding envVars. They're set by /tempura env.
+	CommandEnvVars []corev1.EnvVar `json:"commandEnvVars,omitempty"`
+
+	// +optional
+	// The variables of the templates read from the description of the pull request. The built-in variables can't be overridden.
+	Vars map[string]string `json:"vars,omitempty"`
+
+	// +optional
+	// When true, the Deployments and StatefulSets are created with zero replicas. E.g. for a draft pull request.
+	ScaledDown bool `json:"scaledDown,omitempty"`
+
+	// +optional
+	// The updated_at of the pull request in the latest event applied to the PR. An older event is ignored.
+	LastEventTime *metav1.Time `json:"lastEventTime,omitempty"`
+
+	// +optional
+	// When true, the PR is kept even if the pull request stops matching the filters of the ReviewApp. It's set by /tempura deploy.
+	// The later changes of a pull request not allowed by the authors or the fork policy aren't deployed. E.g. the commits and the description
+	Pinned bool `json:"pinned,omitempty"`
+
+	// +optional
+	// When it's after status.redeployedAt, the resources are deleted and created again. It's set by /tempura redeploy.
+	RedeployRequestedAt *metav1.Time `json:"redeployRequestedAt,omitempty"`
 }
 
 // PRStatus defines the observed state of PR
 type PRStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
+
+	// +optional
+	// The values of the outputs declared in the ReviewApp, read from the applied resources.
+	Outputs map[string]string `json:"outputs,omitempty"`
+
+	// +optional
+	// The outputs which can't be read until the ReviewApp is fixed. E.g. an invalid JSONPath.
+	OutputErrors []OutputError `json:"outputErrors,omitempty"`
+
+	// +optional
+	// The indices allocated by {{allocatedIndex NAME}} in the templates. An index is unique among the PRs of the same ReviewApp.
+	AllocatedIndices map[string]int `json:"allocatedIndices,omitempty"`
+
+	// +optional
+	// The resources which were not created or updated because they exist and aren't controlled by this PR.
+	Conflicts []ResourceConflict `json:"conflicts,omitempty"`
+
+	// +optional
+	// The spec.redeployRequestedAt of the latest redeploy.
+	RedeployedAt *metav1.Time `json:"redeployedAt,omitempty"`
+}
+
+// ResourceConflict is a resource which the PR refused to take over.
+type ResourceConflict struct {
+	// The API version of the resource.
+	APIVersion string `json:"apiVersion"`
+
+	// The kind of the resource.
+	Kind string `json:"kind"`
+
+	// The name of the resource.
+	Name string `json:"name"`
+
+	// Why the resource wasn't taken over.
+	Message string `json:"message"`
+}
+
+// OutputError is an output of the ReviewApp which can't be read.
+type OutputError struct {
+	// The name of the output.
+	Name string `json:"name"`
+
+	// Why the output can't be read.
+	Message string `json:"message"`
 }
 
 //+kubebuilder:object:root=true
@@ -17,6 +17,7 @@ limitations under the License.
 package v1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
@@ -29,15 +30,202 @@ type ReviewAppSpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
 
-	// +kubebuilder:validation:Required
-	// +kubebuilder:validation:MinLength=1
+	// +optional
 	// The GitHub URL of the repository. E.g. https://github.com/kouzoh/mercari-echo-us
-	GithubRepository string `json:"githubRepository"`
+	// OWNER/NAME, HOST/OWNER/NAME and an SSH URL are also accepted, and a segment can have wildcards. E.g. github.com/mercari/*
+	// One of it, GitlabRepository, GiteaRepository or Repositories is required.
+	GithubRepository string `json:"githubRepository,omitempty"`
+
+	// +optional
+	// The GitLab URL of the project for the merge requests. E.g. https://gitlab.example.com/mercari/echo
+	GitlabRepository string `json:"gitlabRepository,omitempty"`
+
+	// +optional
+	// The Gitea URL of the repository. E.g. https://gitea.example.com/mercari/echo
+	GiteaRepository string `json:"giteaRepository,omitempty"`
+
+	// +optional
+	// The repositories on any provider in the same forms as GithubRepository. A repository without a host is of any provider.
+	// The names of the PRs have the repositories, because the numbers of the pull requests are unique only in a repository.
+	Repositories []string `json:"repositories,omitempty"`
 
 	// +kubebuilder:validation:Required
 	// +kubebuilder:pruning:PreserveUnknownFields
 	// Resource is a field for any kind of Kubernetes resources. It can be deployment or service or anything.
 	Resources []unstructured.Unstructured `json:"resources"`
+
+	// +optional
+	// Outputs are values read from the applied resources. Each output becomes a variable for the resources listed after its source resource.
+	Outputs []Output `json:"outputs,omitempty"`
+
+	// +optional
+	// +kubebuilder:validation:Enum=Never;IfOrphaned;Always
+	// AdoptionPolicy decides whether a PR takes over an existing resource which has the same name but isn't controlled by the PR.
+	// Never (default): the resource is left as it is and reported in the status of the PR.
+	// IfOrphaned: the resource is adopted when it isn't controlled by anything.
+	// Always: the resource is adopted even when it's controlled by something else.
+	AdoptionPolicy AdoptionPolicy `json:"adoptionPolicy,omitempty"`
+
+	// +optional
+	// RequiredLabel is the label of a pull request required to create a review app. Removing the label deletes the review app.
+	// All pull requests create a review app when it's empty.
+	RequiredLabel string `json:"requiredLabel,omitempty"`
+
+	// +optional
+	// ExcludedLabel is the label of a pull request to not create a review app. Adding the label deletes the review app.
+	ExcludedLabel string `json:"excludedLabel,omitempty"`
+
+	// +optional
+	// RequiredCheck is the name of a check run or a workflow run which must succeed for a commit before it's deployed. E.g. the build of the images.
+	// The review app keeps the previous commit until then, and isn't created until the first commit passes. Only GitHub supports it.
+	RequiredCheck string `json:"requiredCheck,omitempty"`
+
+	// +optional
+	// BaseBranches filters the pull requests by the branch they're merged into. E.g. main
+	BaseBranches PatternFilter `json:"baseBranches,omitempty"`
+
+	// +optional
+	// HeadBranches filters the pull requests by the branch they're created from. E.g. feature/*
+	HeadBranches PatternFilter `json:"headBranches,omitempty"`
+
+	// +optional
+	// Paths filters the pull requests by the changed files. A pull request matches when one of its changed files matches. E.g. services/web/**
+	Paths PatternFilter `json:"paths,omitempty"`
+
+	// +optional
+	// +kubebuilder:validation:Enum=Deploy;Skip;ScaleDown
+	// DraftPolicy decides how a draft pull request is deployed.
+	// Deploy (default): deployed as well as the others.
+	// Skip: not deployed until it's ready for review.
+	// ScaleDown: deployed with zero replicas of the Deployments and StatefulSets until it's ready for review.
+	DraftPolicy DraftPolicy `json:"draftPolicy,omitempty"`
+
+	// +optional
+	// ForkPolicy decides whether a pull request from a fork is deployed. Its author controls the images to deploy.
+	ForkPolicy ForkPolicy `json:"forkPolicy,omitempty"`
+
+	// +optional
+	// Authors filters the pull requests by their authors. E.g. excluding bots like dependabot[bot]
+	Authors AuthorFilter `json:"authors,omitempty"`
+
+	// +optional
+	// WebhookSecretRef is a Secret in the namespace which has the secrets of the webhook endpoint of the namespace (/webhooks/NAMESPACE).
+	// Each value of the Secret is accepted. The endpoint delivers the events only to the ReviewApps in the namespace.
+	WebhookSecretRef *corev1.LocalObjectReference `json:"webhookSecretRef,omitempty"`
+}
+
+// AuthorFilter filters the pull requests by their authors.
+type AuthorFilter struct {
+	// +optional
+	// An author must match it. All authors match when it's empty.
+	Allow UserFilter `json:"allow,omitempty"`
+
+	// +optional
+	// An author must not match it.
+	Deny UserFilter `json:"deny,omitempty"`
+}
+
+// DraftPolicy decides how a draft pull request is deployed.
+type DraftPolicy string
+
+const (
+	DraftPolicyDeploy    DraftPolicy = "Deploy"
+	DraftPolicySkip      DraftPolicy = "Skip"
+	DraftPolicyScaleDown DraftPolicy = "ScaleDown"
+)
+
+// ForkPolicy decides whether a pull request from a fork is deployed.
+type ForkPolicy struct {
+	// +optional
+	// +kubebuilder:validation:Enum=Deploy;Ignore;RequireLabel;Allowlist
+	// Deploy (default): deployed as well as the others.
+	// Ignore: never deployed.
+	// RequireLabel: deployed while it has the ApprovalLabel. Only the users with the write permission of the repository can add a label.
+	// The label approves the head commit when it is added, and the later commits need the label to be added again.
+	// Allowlist: deployed when its author is in the Allowlist.
+	Mode ForkPolicyMode `json:"mode,omitempty"`
+
+	// +optional
+	// The label which a maintainer adds to approve a pull request from a fork. Used by RequireLabel.
+	ApprovalLabel string `json:"approvalLabel,omitempty"`
+
+	// +optional
+	// The authors allowed to deploy a pull request from a fork. Used by Allowlist.
+	Allowlist UserFilter `json:"allowlist,omitempty"`
+}
+
+// ForkPolicyMode decides whether a pull request from a fork is deployed.
+type ForkPolicyMode string
+
+const (
+	ForkPolicyDeploy       ForkPolicyMode = "Deploy"
+	ForkPolicyIgnore       ForkPolicyMode = "Ignore"
+	ForkPolicyRequireLabel ForkPolicyMode = "RequireLabel"
+	ForkPolicyAllowlist    ForkPolicyMode = "Allowlist"
+)
+
+// UserFilter matches GitHub users by their logins or their teams.
+type UserFilter struct {
+	// +optional
+	// The logins of the users. E.g. octocat
+	Users []string `json:"users,omitempty"`
+
+	// +optional
+	// The teams of the users in the form of ORG/TEAM_SLUG. E.g. mercari/backend
+	// The membership is read from the GitHub REST API, so it needs a token which can read the organization.
+	Teams []string `json:"teams,omitempty"`
+}
+
+// PatternFilter filters values by glob patterns. "*" matches any characters except "/", and "**" matches any characters.
+type PatternFilter struct {
+	// +optional
+	// A value must match one of the patterns. All values match when it's empty.
+	Include []string `json:"include,omitempty"`
+
+	// +optional
+	// A value must match none of the patterns.
+	Exclude []string `json:"exclude,omitempty"`
+}
+
+// AdoptionPolicy decides whether a PR takes over an existing resource.
+type AdoptionPolicy string
+
+const (
+	AdoptionPolicyNever      AdoptionPolicy = "Never"
+	AdoptionPolicyIfOrphaned AdoptionPolicy = "IfOrphaned"
+	AdoptionPolicyAlways     AdoptionPolicy = "Always"
+)
+
+// Output reads a value from an applied resource and exposes it as a template variable.
+type Output struct {
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Pattern=`^[A-Za-z_][A-Za-z0-9_]*$`
+	// The variable name. E.g. LOAD_BALANCER_IP can be used as {{LOAD_BALANCER_IP}}
+	Name string `json:"name"`
+
+	// +kubebuilder:validation:Required
+	// The source resource of the value.
+	Resource OutputResource `json:"resource"`
+
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	// The JSONPath to the value in the source resource. E.g. {.status.loadBalancer.ingress[0].ip}
+	JSONPath string `json:"jsonPath"`
+}
+
+// OutputResource identifies a resource in the Resources of a ReviewApp.
+type OutputResource struct {
+	// +kubebuilder:validation:Required
+	// The API version of the resource. E.g. v1
+	APIVersion string `json:"apiVersion"`
+
+	// +kubebuilder:validation:Required
+	// The kind of the resource. E.g. Service
+	Kind string `json:"kind"`
+
+	// +kubebuilder:validation:Required
+	// The name of the resource. Variables can be used. E.g. reviewapp-sample-pr{{PR_NUMBER}}
+	Name string `json:"name"`
 }
 
 // ReviewAppStatus defines the observed state of ReviewApp
@@ -27,13 +27,117 @@ import (
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AuthorFilter) DeepCopyInto(out *AuthorFilter) {
+	*out = *in
+	in.Allow.DeepCopyInto(&out.Allow)
+	in.Deny.DeepCopyInto(&out.Deny)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AuthorFilter.
+func (in *AuthorFilter) DeepCopy() *AuthorFilter {
+	if in == nil {
+		return nil
+	}
+	out := new(AuthorFilter)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ForkPolicy) DeepCopyInto(out *ForkPolicy) {
+	*out = *in
+	in.Allowlist.DeepCopyInto(&out.Allowlist)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ForkPolicy.
+func (in *ForkPolicy) DeepCopy() *ForkPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(ForkPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Output) DeepCopyInto(out *Output) {
+	*out = *in
+	out.Resource = in.Resource
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Output.
+func (in *Output) DeepCopy() *Output {
+	if in == nil {
+		return nil
+	}
+	out := new(Output)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OutputError) DeepCopyInto(out *OutputError) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OutputError.
+func (in *OutputError) DeepCopy() *OutputError {
+	if in == nil {
+		return nil
+	}
+	out := new(OutputError)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OutputResource) DeepCopyInto(out *OutputResource) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OutputResource.
+func (in *OutputResource) DeepCopy() *OutputResource {
+	if in == nil {
+		return nil
+	}
+	out := new(OutputResource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PatternFilter) DeepCopyInto(out *PatternFilter) {
+	*out = *in
+	if in.Include != nil {
+		in, out := &in.Include, &out.Include
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Exclude != nil {
+		in, out := &in.Exclude, &out.Exclude
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PatternFilter.
+func (in *PatternFilter) DeepCopy() *PatternFilter {
+	if in == nil {
+		return nil
+	}
+	out := new(PatternFilter)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PR) DeepCopyInto(out *PR) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PR.
@@ -96,6 +200,28 @@ func (in *PRSpec) DeepCopyInto(out *PRSpec) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.CommandEnvVars != nil {
+		in, out := &in.CommandEnvVars, &out.CommandEnvVars
+		*out = make([]corev1.EnvVar, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Vars != nil {
+		in, out := &in.Vars, &out.Vars
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.LastEventTime != nil {
+		in, out := &in.LastEventTime, &out.LastEventTime
+		*out = (*in).DeepCopy()
+	}
+	if in.RedeployRequestedAt != nil {
+		in, out := &in.RedeployRequestedAt, &out.RedeployRequestedAt
+		*out = (*in).DeepCopy()
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PRSpec.
@@ -111,6 +237,34 @@ func (in *PRSpec) DeepCopy() *PRSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PRStatus) DeepCopyInto(out *PRStatus) {
 	*out = *in
+	if in.Outputs != nil {
+		in, out := &in.Outputs, &out.Outputs
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.OutputErrors != nil {
+		in, out := &in.OutputErrors, &out.OutputErrors
+		*out = make([]OutputError, len(*in))
+		copy(*out, *in)
+	}
+	if in.AllocatedIndices != nil {
+		in, out := &in.AllocatedIndices, &out.AllocatedIndices
+		*out = make(map[string]int, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Conflicts != nil {
+		in, out := &in.Conflicts, &out.Conflicts
+		*out = make([]ResourceConflict, len(*in))
+		copy(*out, *in)
+	}
+	if in.RedeployedAt != nil {
+		in, out := &in.RedeployedAt, &out.RedeployedAt
+		*out = (*in).DeepCopy()
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PRStatus.
@@ -123,6 +277,21 @@ func (in *PRStatus) DeepCopy() *PRStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ResourceConflict) DeepCopyInto(out *ResourceConflict) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ResourceConflict.
+func (in *ResourceConflict) DeepCopy() *ResourceConflict {
+	if in == nil {
+		return nil
+	}
+	out := new(ResourceConflict)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ReviewApp) DeepCopyInto(out *ReviewApp) {
 	*out = *in
@@ -185,6 +354,11 @@ func (in *ReviewAppList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ReviewAppSpec) DeepCopyInto(out *ReviewAppSpec) {
 	*out = *in
+	if in.Repositories != nil {
+		in, out := &in.Repositories, &out.Repositories
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	if in.Resources != nil {
 		in, out := &in.Resources, &out.Resources
 		*out = make([]unstructured.Unstructured, len(*in))
@@ -192,6 +366,21 @@ func (in *ReviewAppSpec) DeepCopyInto(out *ReviewAppSpec) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.Outputs != nil {
+		in, out := &in.Outputs, &out.Outputs
+		*out = make([]Output, len(*in))
+		copy(*out, *in)
+	}
+	in.BaseBranches.DeepCopyInto(&out.BaseBranches)
+	in.HeadBranches.DeepCopyInto(&out.HeadBranches)
+	in.Paths.DeepCopyInto(&out.Paths)
+	in.ForkPolicy.DeepCopyInto(&out.ForkPolicy)
+	in.Authors.DeepCopyInto(&out.Authors)
+	if in.WebhookSecretRef != nil {
+		in, out := &in.WebhookSecretRef, &out.WebhookSecretRef
+		*out = new(corev1.LocalObjectReference)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReviewAppSpec.
@@ -218,3 +407,28 @@ func (in *ReviewAppStatus) DeepCopy() *ReviewAppStatus {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *UserFilter) DeepCopyInto(out *UserFilter) {
+	*out = *in
+	if in.Users != nil {
+		in, out := &in.Users, &out.Users
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Teams != nil {
+		in, out := &in.Teams, &out.Teams
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new UserFilter.
+func (in *UserFilter) DeepCopy() *UserFilter {
+	if in == nil {
+		return nil
+	}
+	out := new(UserFilter)
+	in.DeepCopyInto(out)
+	return out
+}
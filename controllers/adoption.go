@@ -0,0 +1,53 @@
+package controllers
+
+import (
+	"fmt"
+
+	kubetempurav1 "github.com/mercari/kubetempura/api/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ownershipConflictError means the PR refused to take over an existing resource.
+type ownershipConflictError struct {
+	owner *metav1.OwnerReference
+}
+
+func (e *ownershipConflictError) Error() string {
+	if e.owner == nil {
+		return "the resource already exists and isn't controlled by the PR"
+	}
+	return fmt.Sprintf("the resource is already controlled by %s %s", e.owner.Kind, e.owner.Name)
+}
+
+// adopt prepares the existing resource to be controlled by the PR following the adoption policy.
+// A resource which was just created or is controlled by the PR already is always fine.
+func adopt(pr *kubetempurav1.PR, resource metav1.Object, policy kubetempurav1.AdoptionPolicy) error {
+	if resource.GetResourceVersion() == "" || metav1.IsControlledBy(resource, pr) {
+		return nil
+	}
+	owner := metav1.GetControllerOf(resource)
+	switch policy {
+	case kubetempurav1.AdoptionPolicyAlways:
+		if owner != nil {
+			releaseController(resource)
+		}
+		return nil
+	case kubetempurav1.AdoptionPolicyIfOrphaned:
+		if owner == nil {
+			return nil
+		}
+	}
+	return &ownershipConflictError{owner: owner}
+}
+
+// releaseController removes the owner reference of the current controller.
+func releaseController(resource metav1.Object) {
+	var refs []metav1.OwnerReference
+	for _, ref := range resource.GetOwnerReferences() {
+		if ref.Controller != nil && *ref.Controller {
+			continue
+		}
+		refs = append(refs, ref)
+	}
+	resource.SetOwnerReferences(refs)
+}
@@ -0,0 +1,88 @@
+package controllers
+
+import (
+	"testing"
+
+	kubetempurav1 "github.com/mercari/kubetempura/api/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestAdopt(t *testing.T) {
+	pr := &kubetempurav1.PR{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "kubetempura.mercari.com/v1",
+			Kind:       "PR",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "foo-pr11",
+			UID:  "2cf24a3f-52ac-47c6-b30f-4d2755156549",
+		},
+	}
+	controller := true
+	ownedBy := func(kind, name, uid string) []metav1.OwnerReference {
+		return []metav1.OwnerReference{
+			{APIVersion: "kubetempura.mercari.com/v1", Kind: kind, Name: name, UID: types.UID("2cf24a3f-52ac-47c6-b30f-" + uid), Controller: &controller},
+		}
+	}
+
+	tests := []struct {
+		name            string
+		resourceVersion string
+		ownerReferences []metav1.OwnerReference
+		policy          kubetempurav1.AdoptionPolicy
+		wantErr         bool
+		wantReleased    bool
+	}{
+		{
+			name:   "new resource",
+			policy: kubetempurav1.AdoptionPolicyNever,
+		},
+		{
+			name:            "controlled by the PR",
+			resourceVersion: "1",
+			ownerReferences: ownedBy("PR", "foo-pr11", "4d2755156549"),
+			policy:          kubetempurav1.AdoptionPolicyNever,
+		},
+		{
+			name:            "orphan with the default policy",
+			resourceVersion: "1",
+			wantErr:         true,
+		},
+		{
+			name:            "orphan with IfOrphaned",
+			resourceVersion: "1",
+			policy:          kubetempurav1.AdoptionPolicyIfOrphaned,
+		},
+		{
+			name:            "controlled by another PR with IfOrphaned",
+			resourceVersion: "1",
+			ownerReferences: ownedBy("PR", "foo-pr1", "000000000001"),
+			policy:          kubetempurav1.AdoptionPolicyIfOrphaned,
+			wantErr:         true,
+		},
+		{
+			name:            "controlled by another PR with Always",
+			resourceVersion: "1",
+			ownerReferences: ownedBy("PR", "foo-pr1", "000000000001"),
+			policy:          kubetempurav1.AdoptionPolicyAlways,
+			wantReleased:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resource := &unstructured.Unstructured{Object: map[string]interface{}{}}
+			resource.SetResourceVersion(tt.resourceVersion)
+			resource.SetOwnerReferences(tt.ownerReferences)
+			err := adopt(pr, resource, tt.policy)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("adopt() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if released := len(tt.ownerReferences) != 0 && len(resource.GetOwnerReferences()) == 0; released != tt.wantReleased {
+				t.Fatalf("adopt() released = %v, want %v", released, tt.wantReleased)
+			}
+		})
+	}
+}
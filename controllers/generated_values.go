@@ -0,0 +1,221 @@
+package controllers
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+
+	kubetempurav1 "github.com/mercari/kubetempura/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	randomSecretFunc   = "randomSecret"
+	allocatedIndexFunc = "allocatedIndex"
+
+	defaultRandomSecretLength = 32
+	defaultAllocatedIndexSize = 1000
+
+	randomSecretChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+)
+
+// E.g. {{randomSecret DB_PASSWORD}}, {{randomSecret DB_PASSWORD 16}}, {{allocatedIndex REDIS_DB 16}}
+var generatedValueRegexp = regexp.MustCompile(`\{\{\s*(` + randomSecretFunc + `|` + allocatedIndexFunc + `)\s+([A-Za-z_][A-Za-z0-9_]*)(?:\s+([0-9]+))?\s*\}\}`)
+
+// generatedValueRef is a call of a template function which generates a value once for each PR.
+type generatedValueRef struct {
+	function string
+	name     string
+	// The length of a random secret or the number of indices to allocate from. 0 means the default.
+	arg int
+}
+
+// findGeneratedValueRefs returns the calls of the template functions used in the object. The first call wins when the same name is used twice.
+func findGeneratedValueRefs(a interface{}) []generatedValueRef {
+	var ret []generatedValueRef
+	seen := map[string]bool{}
+	var find func(a interface{})
+	find = func(a interface{}) {
+		switch aa := a.(type) {
+		case string:
+			for _, m := range generatedValueRegexp.FindAllStringSubmatch(aa, -1) {
+				key := m[1] + " " + m[2]
+				if seen[key] {
+					continue
+				}
+				seen[key] = true
+				arg, _ := strconv.Atoi(m[3])
+				ret = append(ret, generatedValueRef{function: m[1], name: m[2], arg: arg})
+			}
+		case map[string]interface{}:
+			for _, v := range aa {
+				find(v)
+			}
+		case []interface{}:
+			for _, v := range aa {
+				find(v)
+			}
+		}
+	}
+	find(a)
+	return ret
+}
+
+// replaceGeneratedValuesRecursive replaces the calls of the template functions with the generated values.
+func replaceGeneratedValuesRecursive(a interface{}, secrets map[string]string, indices map[string]int) interface{} {
+	switch aa := a.(type) {
+	case string:
+		return generatedValueRegexp.ReplaceAllStringFunc(aa, func(s string) string {
+			m := generatedValueRegexp.FindStringSubmatch(s)
+			switch m[1] {
+			case randomSecretFunc:
+				if v, ok := secrets[m[2]]; ok {
+					return v
+				}
+			case allocatedIndexFunc:
+				if v, ok := indices[m[2]]; ok {
+					return strconv.Itoa(v)
+				}
+			}
+			return s
+		})
+	case map[string]interface{}:
+		for k, v := range aa {
+			aa[k] = replaceGeneratedValuesRecursive(v, secrets, indices)
+		}
+	case []interface{}:
+		for i, v := range aa {
+			aa[i] = replaceGeneratedValuesRecursive(v, secrets, indices)
+		}
+	}
+	return a
+}
+
+func randomString(length int) (string, error) {
+	b := make([]byte, length)
+	max := big.NewInt(int64(len(randomSecretChars)))
+	for i := range b {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b[i] = randomSecretChars[n.Int64()]
+	}
+	return string(b), nil
+}
+
+// allocateIndex returns the smallest index in [0, size) which is not used.
+func allocateIndex(size int, used map[int]bool) (int, error) {
+	for i := 0; i < size; i++ {
+		if !used[i] {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("all %d indices are already allocated", size)
+}
+
+func generatedSecretName(pr *kubetempurav1.PR) string {
+	return pr.Name + "-generated"
+}
+
+// ensureRandomSecrets returns the random secrets of the PR. The missing ones are generated and stored in a Secret owned by the PR.
+// An existing Secret of the same name is taken over following the adoption policy. It returns an ownershipConflictError when it isn't.
+func (r *PRReconciler) ensureRandomSecrets(ctx context.Context, pr *kubetempurav1.PR, adoptionPolicy kubetempurav1.AdoptionPolicy, refs []generatedValueRef) (map[string]string, error) {
+	secrets := map[string]string{}
+	var wanted []generatedValueRef
+	for _, ref := range refs {
+		if ref.function == randomSecretFunc {
+			wanted = append(wanted, ref)
+		}
+	}
+	if len(wanted) == 0 {
+		return secrets, nil
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      generatedSecretName(pr),
+			Namespace: pr.Namespace,
+		},
+	}
+	_, err := ctrl.CreateOrUpdate(ctx, r.Client, secret, func() error {
+		if err := adopt(pr, secret, adoptionPolicy); err != nil {
+			return err
+		}
+		if secret.Data == nil {
+			secret.Data = map[string][]byte{}
+		}
+		for _, ref := range wanted {
+			if _, ok := secret.Data[ref.name]; ok {
+				continue
+			}
+			length := ref.arg
+			if length == 0 {
+				length = defaultRandomSecretLength
+			}
+			v, err := randomString(length)
+			if err != nil {
+				return err
+			}
+			secret.Data[ref.name] = []byte(v)
+		}
+		return ctrl.SetControllerReference(pr, secret, r.Scheme)
+	})
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range secret.Data {
+		secrets[k] = string(v)
+	}
+	return secrets, nil
+}
+
+// ensureAllocatedIndices allocates the missing indices of the PR and records them in its status.
+// An index is unique among the PRs of the same ReviewApp. SetupWithManager limits the concurrent reconciles to one,
+// so two PRs never get the same index as long as a single manager runs (e.g. with --leader-elect). Raising MaxConcurrentReconciles needs another way to allocate them.
+func (r *PRReconciler) ensureAllocatedIndices(ctx context.Context, pr *kubetempurav1.PR, refs []generatedValueRef) error {
+	var prs *kubetempurav1.PRList
+	for _, ref := range refs {
+		if ref.function != allocatedIndexFunc {
+			continue
+		}
+		if _, ok := pr.Status.AllocatedIndices[ref.name]; ok {
+			continue
+		}
+		if prs == nil {
+			prs = &kubetempurav1.PRList{}
+			// Read from the API server. The cache may not have the indices allocated by the last reconcile yet.
+			if err := r.APIReader.List(ctx, prs, client.InNamespace(pr.Namespace)); err != nil {
+				return err
+			}
+		}
+		used := map[int]bool{}
+		for _, other := range prs.Items {
+			if other.Name == pr.Name || other.Spec.ParentReviewApp != pr.Spec.ParentReviewApp {
+				continue
+			}
+			if i, ok := other.Status.AllocatedIndices[ref.name]; ok {
+				used[i] = true
+			}
+		}
+		size := ref.arg
+		if size == 0 {
+			size = defaultAllocatedIndexSize
+		}
+		i, err := allocateIndex(size, used)
+		if err != nil {
+			return fmt.Errorf("unable to allocate %s: %w", ref.name, err)
+		}
+		if pr.Status.AllocatedIndices == nil {
+			pr.Status.AllocatedIndices = map[string]int{}
+		}
+		pr.Status.AllocatedIndices[ref.name] = i
+	}
+	return nil
+}
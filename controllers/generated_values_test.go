@@ -0,0 +1,175 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	kubetempurav1 "github.com/mercari/kubetempura/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestFindGeneratedValueRefs(t *testing.T) {
+	obj := map[string]interface{}{
+		"data": map[string]interface{}{
+			"password": "{{randomSecret DB_PASSWORD}}",
+			"url":      "redis://redis:6379/{{ allocatedIndex REDIS_DB 16 }}",
+		},
+		"list": []interface{}{
+			"{{randomSecret DB_PASSWORD 64}}",
+			"{{PR_NUMBER}}",
+		},
+	}
+	got := findGeneratedValueRefs(obj)
+	want := map[string]generatedValueRef{
+		"DB_PASSWORD": {function: randomSecretFunc, name: "DB_PASSWORD"},
+		"REDIS_DB":    {function: allocatedIndexFunc, name: "REDIS_DB", arg: 16},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("findGeneratedValueRefs() = %v, want %v", got, want)
+	}
+	for _, ref := range got {
+		w := want[ref.name]
+		// The order of a map is random, so either call of DB_PASSWORD can win.
+		if ref.name == "DB_PASSWORD" {
+			w.arg = ref.arg
+		}
+		if ref != w {
+			t.Fatalf("findGeneratedValueRefs() = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestReplaceGeneratedValuesRecursive(t *testing.T) {
+	obj := map[string]interface{}{
+		"data": map[string]interface{}{
+			"password": "{{randomSecret DB_PASSWORD}}",
+			"url":      "redis://redis:6379/{{ allocatedIndex REDIS_DB 16 }}",
+			"unknown":  "{{randomSecret UNKNOWN}}",
+		},
+	}
+	want := map[string]interface{}{
+		"data": map[string]interface{}{
+			"password": "s3cr3t",
+			"url":      "redis://redis:6379/3",
+			"unknown":  "{{randomSecret UNKNOWN}}",
+		},
+	}
+	got := replaceGeneratedValuesRecursive(obj, map[string]string{"DB_PASSWORD": "s3cr3t"}, map[string]int{"REDIS_DB": 3})
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("replaceGeneratedValuesRecursive() = %v, want %v", got, want)
+	}
+}
+
+func TestAllocateIndex(t *testing.T) {
+	tests := []struct {
+		name    string
+		size    int
+		used    map[int]bool
+		want    int
+		wantErr bool
+	}{
+		{
+			name: "first",
+			size: 16,
+			used: map[int]bool{},
+			want: 0,
+		},
+		{
+			name: "fill a gap",
+			size: 16,
+			used: map[int]bool{0: true, 2: true},
+			want: 1,
+		},
+		{
+			name:    "exhausted",
+			size:    2,
+			used:    map[int]bool{0: true, 1: true},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := allocateIndex(tt.size, tt.used)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("allocateIndex() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Fatalf("allocateIndex() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRandomString(t *testing.T) {
+	a, err := randomString(32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := randomString(32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a) != 32 || a == b {
+		t.Fatalf("randomString() = %v, %v", a, b)
+	}
+}
+
+func TestEnsureRandomSecretsAdoption(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := kubetempurav1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	pr := &kubetempurav1.PR{ObjectMeta: metav1.ObjectMeta{Name: "foo-pr1", Namespace: "default", UID: "2cf24a3f-52ac-47c6-b30f-4d2755156549"}}
+	refs := []generatedValueRef{{function: randomSecretFunc, name: "PASSWORD"}}
+
+	tests := []struct {
+		name    string
+		policy  kubetempurav1.AdoptionPolicy
+		wantErr bool
+	}{
+		{name: "Never", policy: kubetempurav1.AdoptionPolicyNever, wantErr: true},
+		{name: "IfOrphaned", policy: kubetempurav1.AdoptionPolicyIfOrphaned},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// A Secret of the same name which isn't controlled by the PR.
+			existing := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: generatedSecretName(pr), Namespace: "default"},
+				Data:       map[string][]byte{"PASSWORD": []byte("existing")},
+			}
+			c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(existing).Build()
+			r := &PRReconciler{Client: c, Scheme: scheme}
+			secrets, err := r.ensureRandomSecrets(context.Background(), pr, tt.policy, refs)
+			var conflict *ownershipConflictError
+			if errors.As(err, &conflict) != tt.wantErr {
+				t.Fatalf("ensureRandomSecrets() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if secrets["PASSWORD"] != "existing" {
+				t.Fatalf("secrets = %v, want the value of the adopted Secret", secrets)
+			}
+			var got corev1.Secret
+			if err := c.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: generatedSecretName(pr)}, &got); err != nil {
+				t.Fatal(err)
+			}
+			if !metav1.IsControlledBy(&got, pr) {
+				t.Fatalf("owner references = %v, want the Secret controlled by the PR", got.OwnerReferences)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package controllers
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	kubetempurav1 "github.com/mercari/kubetempura/api/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/util/jsonpath"
+)
+
+// isOutputSource returns true when the applied resource is the one the output reads from.
+func isOutputSource(output kubetempurav1.Output, resource unstructured.Unstructured, vars map[string]string) bool {
+	return output.Resource.APIVersion == resource.GetAPIVersion() &&
+		output.Resource.Kind == resource.GetKind() &&
+		replacePlaceholders(output.Resource.Name, vars) == resource.GetName()
+}
+
+// pendingOutputs returns the names of the outputs which don't have a value yet.
+func pendingOutputs(outputs []kubetempurav1.Output, values map[string]string) []string {
+	var ret []string
+	for _, output := range outputs {
+		if _, ok := values[output.Name]; !ok {
+			ret = append(ret, output.Name)
+		}
+	}
+	return ret
+}
+
+var (
+	// simpleOutputPath matches a JSONPath of only the fields and the indices. E.g. {.status.loadBalancer.ingress[0].ip}
+	simpleOutputPath = regexp.MustCompile(`^\{(?:\.[\w-]+|\[-?\d+\])+\}$`)
+	// outputPathSegment matches a field or an index of a simple JSONPath.
+	outputPathSegment = regexp.MustCompile(`\.[\w-]+|\[-?\d+\]`)
+)
+
+// outputPath is the parsed JSONPath of an output.
+type outputPath struct {
+	jsonPath *jsonpath.JSONPath
+	// text is the JSONPath with the braces. JSONPath doesn't expose the parsed nodes, so it's read again when the JSONPath fails.
+	text string
+}
+
+// parseOutputPath parses the JSONPath of an output. It accepts both "{.status.foo}" and ".status.foo" like kubectl does.
+func parseOutputPath(path string) (*outputPath, error) {
+	if !strings.HasPrefix(path, "{") {
+		path = "{" + path + "}"
+	}
+	j := jsonpath.New("output")
+	j.AllowMissingKeys(true)
+	if err := j.Parse(path); err != nil {
+		return nil, fmt.Errorf("invalid JSONPath %q: %w", path, err)
+	}
+	return &outputPath{jsonPath: j, text: path}, nil
+}
+
+// parseOutputPaths parses the JSONPaths of the outputs by name.
+// An invalid one is returned as an error for the status instead, because a retry doesn't fix it.
+func parseOutputPaths(outputs []kubetempurav1.Output) (map[string]*outputPath, []kubetempurav1.OutputError) {
+	paths := map[string]*outputPath{}
+	var errs []kubetempurav1.OutputError
+	for _, output := range outputs {
+		path, err := parseOutputPath(output.JSONPath)
+		if err != nil {
+			errs = append(errs, kubetempurav1.OutputError{Name: output.Name, Message: err.Error()})
+			continue
+		}
+		paths[output.Name] = path
+	}
+	return paths, errs
+}
+
+// readableOutputs returns the names which have a valid JSONPath, so they are read by a retry.
+func readableOutputs(names []string, paths map[string]*outputPath) []string {
+	var ret []string
+	for _, name := range names {
+		if _, ok := paths[name]; ok {
+			ret = append(ret, name)
+		}
+	}
+	return ret
+}
+
+// readOutput evaluates the JSONPath against the resource.
+// It returns an empty string when the value doesn't exist yet. E.g. the IP of a LoadBalancer which is not assigned yet.
+func readOutput(resource unstructured.Unstructured, path *outputPath) (string, error) {
+	buf := new(bytes.Buffer)
+	if err := path.jsonPath.Execute(buf, resource.Object); err != nil {
+		// An empty list (e.g. status.loadBalancer.ingress) makes an index out of range. It isn't available yet.
+		if indexesBeyondList(path.text, resource.Object) {
+			return "", nil
+		}
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// indexesBeyondList returns true when an index of the path is beyond the length of the list. E.g. {.status.loadBalancer.ingress[0]} of an empty list
+// Only a path of the fields and the indices is followed, because the others don't fail for the missing values.
+func indexesBeyondList(text string, obj map[string]interface{}) bool {
+	if !simpleOutputPath.MatchString(text) {
+		return false
+	}
+	var value interface{} = obj
+	for _, segment := range outputPathSegment.FindAllString(text, -1) {
+		if strings.HasPrefix(segment, ".") {
+			m, ok := value.(map[string]interface{})
+			if !ok {
+				return false
+			}
+			value = m[segment[1:]]
+			continue
+		}
+		list, ok := value.([]interface{})
+		if !ok {
+			return false
+		}
+		index, err := strconv.Atoi(segment[1 : len(segment)-1])
+		if err != nil {
+			return false
+		}
+		if index < 0 {
+			index += len(list)
+		}
+		if index < 0 || index >= len(list) {
+			return true
+		}
+		value = list[index]
+	}
+	return false
+}
@@ -0,0 +1,179 @@
+package controllers
+
+import (
+	"testing"
+
+	kubetempurav1 "github.com/mercari/kubetempura/api/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestReadOutput(t *testing.T) {
+	service := unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Service",
+			"metadata": map[string]interface{}{
+				"name": "foo-10",
+			},
+			"spec": map[string]interface{}{
+				"clusterIP": "10.0.255.0",
+			},
+			"status": map[string]interface{}{
+				"loadBalancer": map[string]interface{}{
+					"ingress": []interface{}{},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		jsonPath string
+		want     string
+		wantErr  bool
+	}{
+		{
+			name:     "with braces",
+			jsonPath: "{.spec.clusterIP}",
+			want:     "10.0.255.0",
+		},
+		{
+			name:     "without braces",
+			jsonPath: ".spec.clusterIP",
+			want:     "10.0.255.0",
+		},
+		{
+			name:     "missing key",
+			jsonPath: "{.spec.loadBalancerIP}",
+			want:     "",
+		},
+		{
+			name:     "not assigned yet",
+			jsonPath: "{.status.loadBalancer.ingress[0].ip}",
+			want:     "",
+		},
+		{
+			name:     "last of an empty list",
+			jsonPath: "{.status.loadBalancer.ingress[-1].ip}",
+			want:     "",
+		},
+		{
+			name:     "not a list",
+			jsonPath: "{.spec.clusterIP[0]}",
+			wantErr:  true,
+		},
+		{
+			name:     "invalid",
+			jsonPath: "{.spec[}",
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, err := parseOutputPath(tt.jsonPath)
+			if err != nil {
+				if !tt.wantErr {
+					t.Fatalf("parseOutputPath() error = %v", err)
+				}
+				return
+			}
+			got, err := readOutput(service, path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readOutput() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Fatalf("readOutput() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIndexesBeyondList(t *testing.T) {
+	obj := map[string]interface{}{
+		"status": map[string]interface{}{
+			"ingress": []interface{}{map[string]interface{}{"ports": []interface{}{}}},
+		},
+	}
+	tests := []struct {
+		text string
+		want bool
+	}{
+		{text: "{.status.ingress[0].ports[0]}", want: true},
+		{text: "{.status.ingress[-2]}", want: true},
+		{text: "{.status.ingress[0]}"},
+		{text: "{.status.ingress[0].ports}"},
+		// Only the fields and the indices are followed.
+		{text: "{.status.ingress[*].ports[0]}"},
+		{text: "{.status['ingress'][1]}"},
+	}
+	for _, tt := range tests {
+		if got := indexesBeyondList(tt.text, obj); got != tt.want {
+			t.Errorf("indexesBeyondList(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestParseOutputPaths(t *testing.T) {
+	outputs := []kubetempurav1.Output{
+		{Name: "IP", JSONPath: "{.spec.clusterIP}"},
+		{Name: "HOST", JSONPath: "{.spec[}"},
+	}
+	paths, errs := parseOutputPaths(outputs)
+	if _, ok := paths["IP"]; !ok || len(paths) != 1 {
+		t.Fatalf("paths = %v, want only IP", paths)
+	}
+	if len(errs) != 1 || errs[0].Name != "HOST" || errs[0].Message == "" {
+		t.Fatalf("errors = %v, want the error of HOST", errs)
+	}
+	// HOST isn't retried until the ReviewApp is fixed.
+	if got := readableOutputs([]string{"IP", "HOST"}, paths); len(got) != 1 || got[0] != "IP" {
+		t.Fatalf("readableOutputs() = %v, want [IP]", got)
+	}
+}
+
+func TestIsOutputSource(t *testing.T) {
+	resource := unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Service",
+			"metadata": map[string]interface{}{
+				"name": "foo-10",
+			},
+		},
+	}
+	vars := map[string]string{
+		"PR_NUMBER": "10",
+	}
+
+	tests := []struct {
+		name     string
+		resource kubetempurav1.OutputResource
+		want     bool
+	}{
+		{
+			name:     "match with placeholders",
+			resource: kubetempurav1.OutputResource{APIVersion: "v1", Kind: "Service", Name: "foo-{{PR_NUMBER}}"},
+			want:     true,
+		},
+		{
+			name:     "another name",
+			resource: kubetempurav1.OutputResource{APIVersion: "v1", Kind: "Service", Name: "bar-{{PR_NUMBER}}"},
+			want:     false,
+		},
+		{
+			name:     "another kind",
+			resource: kubetempurav1.OutputResource{APIVersion: "apps/v1", Kind: "Deployment", Name: "foo-{{PR_NUMBER}}"},
+			want:     false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output := kubetempurav1.Output{Name: "IP", Resource: tt.resource, JSONPath: "{.spec.clusterIP}"}
+			if got := isOutputSource(output, resource, vars); got != tt.want {
+				t.Fatalf("isOutputSource() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
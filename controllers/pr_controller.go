@@ -18,19 +18,36 @@ package controllers
 
 import (
 	"context"
+	"errors"
+	"reflect"
+	"time"
 
 	kubetempurav1 "github.com/mercari/kubetempura/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
+const (
+	// retryInterval is the interval to reconcile again when some resources are not ready yet.
+	// E.g. outputs which are not available yet, or resources being recreated.
+	retryInterval = 10 * time.Second
+)
+
 // PRReconciler reconciles a PR object
 type PRReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
+	// APIReader reads objects from the API server directly, bypassing the cache.
+	APIReader client.Reader
 }
 
 //+kubebuilder:rbac:groups=kubetempura.mercari.com,resources=prs,verbs=get;list;watch;create;update;patch;delete
@@ -63,36 +80,194 @@ func (r *PRReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Re
 		return ctrl.Result{}, err
 	}
 
-	vars := map[string]string{
-		"PR_NUMBER":        pr.Spec.PRNumber,
-		"COMMIT_REF":       pr.Spec.HeadCommitRef,
-		"COMMIT_REF_SHORT": commitRefShort(pr.Spec.HeadCommitRef),
+	vars := prVars(pr)
+	envVars := prEnvVars(pr)
+	status := pr.Status.DeepCopy()
+
+	refs := findGeneratedValueRefs(templateValues(reviewApp.Spec.Resources, envVars))
+	secrets, err := r.ensureRandomSecrets(ctx, pr, reviewApp.Spec.AdoptionPolicy, refs)
+	var conflict *ownershipConflictError
+	if errors.As(err, &conflict) {
+		// The resources can't be rendered without the secrets. They are applied when the PR is reconciled again after the Secret is fixed.
+		l.Info("Refused to take over the Secret of the generated values.", "reason", conflict.Error(), "ns", pr.Namespace, "name", generatedSecretName(pr))
+		pr.Status.Conflicts = []kubetempurav1.ResourceConflict{{
+			APIVersion: "v1",
+			Kind:       "Secret",
+			Name:       generatedSecretName(pr),
+			Message:    conflict.Error(),
+		}}
+		if !reflect.DeepEqual(status, &pr.Status) {
+			if err := r.Status().Update(ctx, pr); err != nil {
+				l.Error(err, "Unable to update the status of the PR.")
+				return ctrl.Result{}, err
+			}
+		}
+		return ctrl.Result{}, nil
+	}
+	if err != nil {
+		l.Error(err, "Unable to generate the random secrets.")
+		return ctrl.Result{}, err
+	}
+	if err := r.ensureAllocatedIndices(ctx, pr, refs); err != nil {
+		l.Error(err, "Unable to allocate the indices.")
+		return ctrl.Result{}, err
+	}
+	if !reflect.DeepEqual(status, &pr.Status) {
+		// Record the allocated indices before using them.
+		if err := r.Status().Update(ctx, pr); err != nil {
+			l.Error(err, "Unable to update the status of the PR.")
+			return ctrl.Result{}, err
+		}
+		status = pr.Status.DeepCopy()
 	}
 
+	if redeployRequested(pr) {
+		if err := r.deleteResources(ctx, reviewApp, pr, vars, secrets); err != nil {
+			l.Error(err, "Unable to delete the resources to redeploy them.")
+			return ctrl.Result{}, err
+		}
+		pr.Status.RedeployedAt = pr.Spec.RedeployRequestedAt.DeepCopy()
+		if err := r.Status().Update(ctx, pr); err != nil {
+			l.Error(err, "Unable to update the status of the PR.")
+			return ctrl.Result{}, err
+		}
+		l.Info("Deleted the resources to redeploy them.")
+		return ctrl.Result{RequeueAfter: retryInterval}, nil
+	}
+
+	var outputs map[string]string
+	paths, outputErrors := parseOutputPaths(reviewApp.Spec.Outputs)
+	for _, outputError := range outputErrors {
+		l.Info("Unable to read the output.", "output", outputError.Name, "reason", outputError.Message)
+	}
+	var conflicts []kubetempurav1.ResourceConflict
+	recreating := false
 	for _, resourceTemplate := range reviewApp.Spec.Resources {
-		resource := applyTemplate(resourceTemplate, vars, pr.Spec.EnvVars)
+		if name, ok := referencedVariable(resourceTemplate.Object, pendingOutputs(reviewApp.Spec.Outputs, outputs)); ok {
+			l.Info("Skipped the resource because the output is not available yet.", "output", name, "name", resourceTemplate.GetName())
+			continue
+		}
+		resource := applyTemplate(resourceTemplate, vars, envVars)
+		resource.Object = replaceGeneratedValuesRecursive(resource.Object, secrets, pr.Status.AllocatedIndices).(map[string]interface{})
 		resource.SetNamespace(req.Namespace)
-		rendered := *resource.DeepCopy()
 
 		// TODO: So far, it doesn't support a case when ReviewApp updated and a child resource is removed from ReviewApp
-		ret, err := ctrl.CreateOrUpdate(ctx, r.Client, &resource, func() error {
-			resource.Object = mergeResourceConfigs(rendered, resource).Object
-			return ctrl.SetControllerReference(pr, &resource, r.Scheme)
-		})
+		ret, err := r.applyResource(ctx, pr, reviewApp.Spec.AdoptionPolicy, &resource)
+		var conflict *ownershipConflictError
+		if errors.As(err, &conflict) {
+			l.Info("Refused to take over the resource.", "reason", conflict.Error(), "ns", resource.GetNamespace(), "name", resource.GetName())
+			conflicts = append(conflicts, kubetempurav1.ResourceConflict{
+				APIVersion: resource.GetAPIVersion(),
+				Kind:       resource.GetKind(),
+				Name:       resource.GetName(),
+				Message:    conflict.Error(),
+			})
+			continue
+		}
 		if err != nil {
 			l.Error(err, "Unable to create or update the resource.", "ns", resource.GetNamespace(), "name", resource.GetName())
-		} else {
-			l.Info("Created or updated the resource.", "result", string(ret), "ns", resource.GetNamespace(), "name", resource.GetName())
+			continue
+		}
+		if ret == operationResultRecreating {
+			l.Info("Deleted the resource to recreate it.", "ns", resource.GetNamespace(), "name", resource.GetName())
+			recreating = true
+			continue
+		}
+		l.Info("Created or updated the resource.", "result", string(ret), "ns", resource.GetNamespace(), "name", resource.GetName())
+
+		for _, output := range reviewApp.Spec.Outputs {
+			path, ok := paths[output.Name]
+			if !ok || !isOutputSource(output, resource, vars) {
+				continue
+			}
+			value, err := readOutput(resource, path)
+			if err != nil {
+				l.Error(err, "Unable to read the output.", "output", output.Name)
+			}
+			if value == "" {
+				continue
+			}
+			if outputs == nil {
+				outputs = map[string]string{}
+			}
+			vars[output.Name] = value
+			outputs[output.Name] = value
+		}
+	}
+
+	pr.Status.Outputs = outputs
+	pr.Status.OutputErrors = outputErrors
+	pr.Status.Conflicts = conflicts
+	if !reflect.DeepEqual(status, &pr.Status) {
+		if err := r.Status().Update(ctx, pr); err != nil {
+			l.Error(err, "Unable to update the status of the PR.")
+			return ctrl.Result{}, err
 		}
 	}
 
+	// The outputs with the errors in the status aren't retried.
+	if pending := readableOutputs(pendingOutputs(reviewApp.Spec.Outputs, outputs), paths); len(pending) != 0 {
+		l.Info("Some outputs are not available yet.", "outputs", pending)
+		return ctrl.Result{RequeueAfter: retryInterval}, nil
+	}
+	if recreating {
+		return ctrl.Result{RequeueAfter: retryInterval}, nil
+	}
 	return ctrl.Result{}, nil
 }
 
+// applyResource creates or updates the resource following the update policy in its annotations.
+// It returns an ownershipConflictError when the resource exists and the adoption policy doesn't allow to take it over.
+func (r *PRReconciler) applyResource(ctx context.Context, pr *kubetempurav1.PR, adoptionPolicy kubetempurav1.AdoptionPolicy, resource *unstructured.Unstructured) (controllerutil.OperationResult, error) {
+	rendered := *resource.DeepCopy()
+	policy := updatePolicy(rendered)
+	fields, err := ignoredFields(rendered)
+	if err != nil {
+		// The valid fields are still kept.
+		log.FromContext(ctx).Error(err, "Ignored the invalid fields of the annotation.", "annotation", ignoreFieldsAnnotation, "ns", rendered.GetNamespace(), "name", rendered.GetName())
+	}
+
+	ret, err := ctrl.CreateOrUpdate(ctx, r.Client, resource, func() error {
+		if resource.GetDeletionTimestamp() != nil {
+			return errBeingDeleted
+		}
+		if err := adopt(pr, resource, adoptionPolicy); err != nil {
+			return err
+		}
+		if policy == updatePolicyCreateOnly && resource.GetResourceVersion() != "" {
+			return nil
+		}
+		existing := *resource.DeepCopy()
+		merged := restoreIgnoredFields(mergeResourceConfigs(rendered, existing), existing, fields)
+		if pr.Spec.ScaledDown {
+			// It wins against the ignored fields. E.g. spec.replicas managed by a HorizontalPodAutoscaler.
+			merged = scaleDown(merged, existing)
+		} else {
+			merged = scaleUp(merged, rendered, existing, fields)
+		}
+		resource.Object = merged.Object
+		return ctrl.SetControllerReference(pr, resource, r.Scheme)
+	})
+	if err == errBeingDeleted {
+		// E.g. deleted by a redeploy, and waiting for the finalizers.
+		return operationResultRecreating, nil
+	}
+	if err != nil && policy == updatePolicyRecreate && apierrors.IsInvalid(err) && resource.GetResourceVersion() != "" {
+		// Immutable fields are changed. It will be created on the next reconcile after the deletion is completed.
+		if err := r.Delete(ctx, resource, client.PropagationPolicy(metav1.DeletePropagationBackground)); err != nil {
+			return controllerutil.OperationResultNone, client.IgnoreNotFound(err)
+		}
+		return operationResultRecreating, nil
+	}
+	return ret, err
+}
+
 // SetupWithManager sets up the controller with the Manager.
+// The PRs are reconciled one by one, so the allocated indices are unique. See ensureAllocatedIndices.
 func (r *PRReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&kubetempurav1.PR{}).
+		WithOptions(controller.Options{MaxConcurrentReconciles: 1}).
 		Complete(r)
 }
 
@@ -107,3 +282,45 @@ func commitRefShort(commitRefSha string) string {
 	// characters, then switch to using COMMIT_REF when tagging Docker images.
 	return commitRefSha[:7]
 }
+
+// referencedVariable returns the first variable in names which is used in the object.
+func referencedVariable(obj map[string]interface{}, names []string) (string, bool) {
+	for _, name := range names {
+		if referencesVariable(obj, name) {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// templateValues returns all values which can contain placeholders.
+func templateValues(resources []unstructured.Unstructured, envVars []corev1.EnvVar) []interface{} {
+	var ret []interface{}
+	for _, resource := range resources {
+		ret = append(ret, resource.Object)
+	}
+	for _, envVar := range envVars {
+		ret = append(ret, envVar.Value)
+	}
+	return ret
+}
+
+// prVars returns the variables of the templates for the PR. The built-in ones override the ones in the description.
+func prVars(pr *kubetempurav1.PR) map[string]string {
+	vars := map[string]string{}
+	for k, v := range pr.Spec.Vars {
+		vars[k] = v
+	}
+	vars["PR_NUMBER"] = pr.Spec.PRNumber
+	vars["PR_NAME"] = pr.Name
+	vars["COMMIT_REF"] = pr.Spec.HeadCommitRef
+	vars["COMMIT_REF_SHORT"] = commitRefShort(pr.Spec.HeadCommitRef)
+	return vars
+}
+
+// prEnvVars returns the environment variables of the PR. The ones set by /tempura env override the ones in the description.
+func prEnvVars(pr *kubetempurav1.PR) []corev1.EnvVar {
+	envVars := make([]corev1.EnvVar, 0, len(pr.Spec.EnvVars)+len(pr.Spec.CommandEnvVars))
+	envVars = append(envVars, pr.Spec.EnvVars...)
+	return append(envVars, pr.Spec.CommandEnvVars...)
+}
@@ -0,0 +1,59 @@
+package controllers
+
+import (
+	"reflect"
+	"testing"
+
+	kubetempurav1 "github.com/mercari/kubetempura/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestPRVars(t *testing.T) {
+	pr := &kubetempurav1.PR{
+		ObjectMeta: metav1.ObjectMeta{Name: "web-pr1"},
+		Spec: kubetempurav1.PRSpec{
+			PRNumber:      "1",
+			HeadCommitRef: "0123456789abcdef",
+			Vars:          map[string]string{"IMAGE_TAG": "v1.2.3", "PR_NUMBER": "2"},
+		},
+	}
+	want := map[string]string{
+		"IMAGE_TAG":        "v1.2.3",
+		"PR_NUMBER":        "1",
+		"PR_NAME":          "web-pr1",
+		"COMMIT_REF":       "0123456789abcdef",
+		"COMMIT_REF_SHORT": "0123456",
+	}
+	if got := prVars(pr); !reflect.DeepEqual(got, want) {
+		t.Fatalf("prVars() = %v, want %v", got, want)
+	}
+}
+
+func TestPREnvVars(t *testing.T) {
+	pr := &kubetempurav1.PR{
+		Spec: kubetempurav1.PRSpec{
+			EnvVars:        []corev1.EnvVar{{Name: "FOO", Value: "description"}, {Name: "BAR", Value: "description"}},
+			CommandEnvVars: []corev1.EnvVar{{Name: "FOO", Value: "command"}},
+		},
+	}
+	deployment := map[string]interface{}{
+		"kind": "Deployment",
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"containers": []interface{}{map[string]interface{}{"name": "app"}},
+				},
+			},
+		},
+	}
+	applyEnvVars(deployment, prEnvVars(pr))
+	got := deployment["spec"].(map[string]interface{})["template"].(map[string]interface{})["spec"].(map[string]interface{})["containers"].([]interface{})[0].(map[string]interface{})["env"]
+	want := []interface{}{
+		map[string]interface{}{"name": "FOO", "value": "command"},
+		map[string]interface{}{"name": "BAR", "value": "description"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("env = %v, want %v", got, want)
+	}
+}
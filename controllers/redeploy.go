@@ -0,0 +1,56 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+
+	kubetempurav1 "github.com/mercari/kubetempura/api/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// errBeingDeleted means the resource is being deleted. It's created again after the deletion is completed.
+var errBeingDeleted = errors.New("the resource is being deleted")
+
+// redeployRequested returns true when a redeploy was requested after the latest one.
+func redeployRequested(pr *kubetempurav1.PR) bool {
+	requested := pr.Spec.RedeployRequestedAt
+	if requested == nil {
+		return false
+	}
+	return pr.Status.RedeployedAt == nil || pr.Status.RedeployedAt.Before(requested)
+}
+
+// deleteResources deletes the resources of the PR, so they are created again on the next reconcile.
+// The resources not controlled by the PR are kept. The generated secrets and the allocated indices are kept too.
+func (r *PRReconciler) deleteResources(ctx context.Context, reviewApp *kubetempurav1.ReviewApp, pr *kubetempurav1.PR, vars map[string]string, secrets map[string]string) error {
+	// The outputs of the last reconcile render the names of the resources depending on them.
+	for k, v := range pr.Status.Outputs {
+		vars[k] = v
+	}
+	for _, resourceTemplate := range reviewApp.Spec.Resources {
+		if _, ok := referencedVariable(resourceTemplate.Object, pendingOutputs(reviewApp.Spec.Outputs, pr.Status.Outputs)); ok {
+			continue
+		}
+		resource := applyTemplate(resourceTemplate, vars, prEnvVars(pr))
+		resource.Object = replaceGeneratedValuesRecursive(resource.Object, secrets, pr.Status.AllocatedIndices).(map[string]interface{})
+		existing := &unstructured.Unstructured{}
+		existing.SetGroupVersionKind(resource.GroupVersionKind())
+		err := r.Get(ctx, types.NamespacedName{Namespace: pr.Namespace, Name: resource.GetName()}, existing)
+		if err != nil {
+			if client.IgnoreNotFound(err) != nil {
+				return err
+			}
+			continue
+		}
+		if !metav1.IsControlledBy(existing, pr) {
+			continue
+		}
+		if err := r.Delete(ctx, existing, client.PropagationPolicy(metav1.DeletePropagationBackground)); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+	return nil
+}
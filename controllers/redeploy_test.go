@@ -0,0 +1,36 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	kubetempurav1 "github.com/mercari/kubetempura/api/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRedeployRequested(t *testing.T) {
+	older := metav1.NewTime(time.Date(2021, 7, 1, 0, 0, 0, 0, time.UTC))
+	newer := metav1.NewTime(older.Add(time.Minute))
+	tests := []struct {
+		name       string
+		requested  *metav1.Time
+		redeployed *metav1.Time
+		want       bool
+	}{
+		{name: "never requested", want: false},
+		{name: "requested", requested: &older, want: true},
+		{name: "requested again", requested: &newer, redeployed: &older, want: true},
+		{name: "redeployed", requested: &older, redeployed: &older, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pr := &kubetempurav1.PR{
+				Spec:   kubetempurav1.PRSpec{RedeployRequestedAt: tt.requested},
+				Status: kubetempurav1.PRStatus{RedeployedAt: tt.redeployed},
+			}
+			if got := redeployRequested(pr); got != tt.want {
+				t.Fatalf("redeployRequested() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
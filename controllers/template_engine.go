@@ -2,6 +2,7 @@ package controllers
 
 import (
 	"regexp"
+	"strconv"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
@@ -94,6 +95,91 @@ func replacePlaceholders(s string, vars map[string]string) string {
 	return s
 }
 
+// replicasAnnotation records spec.replicas of a workload before it's scaled down, so scaleUp restores it.
+// An empty value means the field wasn't set.
+const replicasAnnotation = "kubetempura.mercari.com/replicas-before-scale-down"
+
+// scaleDown sets zero replicas to a workload. The replicas before that are recorded in the annotation unless the existing one has it already.
+func scaleDown(obj unstructured.Unstructured, existing unstructured.Unstructured) unstructured.Unstructured {
+	switch obj.GetKind() {
+	case "Deployment", "StatefulSet":
+	default:
+		return obj
+	}
+	n := *obj.DeepCopy()
+	recorded, ok := existing.GetAnnotations()[replicasAnnotation]
+	if !ok {
+		recorded = ""
+		if replicas, found, err := unstructured.NestedInt64(obj.Object, "spec", "replicas"); err == nil && found {
+			recorded = strconv.FormatInt(replicas, 10)
+		}
+	}
+	if err := unstructured.SetNestedField(n.Object, int64(0), "spec", "replicas"); err != nil {
+		return obj
+	}
+	setAnnotation(&n, replicasAnnotation, recorded)
+	return n
+}
+
+// scaleUp restores the replicas recorded by scaleDown. The replicas in the template win unless they're ignored.
+// Otherwise, the merged resource would keep zero replicas, because the existing ones are kept. E.g. for a HorizontalPodAutoscaler
+func scaleUp(obj unstructured.Unstructured, rendered unstructured.Unstructured, existing unstructured.Unstructured, fields [][]string) unstructured.Unstructured {
+	recorded, ok := existing.GetAnnotations()[replicasAnnotation]
+	if !ok {
+		return obj
+	}
+	n := *obj.DeepCopy()
+	annotations := n.GetAnnotations()
+	delete(annotations, replicasAnnotation)
+	n.SetAnnotations(annotations)
+	if _, found, _ := unstructured.NestedFieldNoCopy(rendered.Object, "spec", "replicas"); found && !isIgnoredField(fields, "spec", "replicas") {
+		return n
+	}
+	if recorded == "" {
+		unstructured.RemoveNestedField(n.Object, "spec", "replicas")
+		return n
+	}
+	replicas, err := strconv.ParseInt(recorded, 10, 64)
+	if err != nil {
+		unstructured.RemoveNestedField(n.Object, "spec", "replicas")
+		return n
+	}
+	if err := unstructured.SetNestedField(n.Object, replicas, "spec", "replicas"); err != nil {
+		return obj
+	}
+	return n
+}
+
+func setAnnotation(obj *unstructured.Unstructured, key string, value string) {
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[key] = value
+	obj.SetAnnotations(annotations)
+}
+
+// referencesVariable returns true when the placeholder of the variable is used somewhere in the object.
+func referencesVariable(a interface{}, name string) bool {
+	switch aa := a.(type) {
+	case string:
+		return regexp.MustCompile(`\{\{\s*?` + name + `\s*?\}\}`).MatchString(aa)
+	case map[string]interface{}:
+		for _, v := range aa {
+			if referencesVariable(v, name) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, v := range aa {
+			if referencesVariable(v, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func mergeResourceConfigs(rendered unstructured.Unstructured, existing unstructured.Unstructured) unstructured.Unstructured {
 	n := *existing.DeepCopy()
 	metadata, ok := n.Object["metadata"]
@@ -259,3 +259,173 @@ func TestMergeResourceConfigs(t *testing.T) {
 		})
 	}
 }
+
+func TestScaleDown(t *testing.T) {
+	tests := []struct {
+		name     string
+		obj      unstructured.Unstructured
+		existing unstructured.Unstructured
+		want     unstructured.Unstructured
+	}{
+		{
+			name: "deployment",
+			obj: unstructured.Unstructured{
+				Object: map[string]interface{}{
+					"kind": "Deployment",
+					"spec": map[string]interface{}{
+						"replicas": int64(3),
+					},
+				},
+			},
+			want: unstructured.Unstructured{
+				Object: map[string]interface{}{
+					"kind": "Deployment",
+					"metadata": map[string]interface{}{
+						"annotations": map[string]interface{}{replicasAnnotation: "3"},
+					},
+					"spec": map[string]interface{}{
+						"replicas": int64(0),
+					},
+				},
+			},
+		},
+		{
+			name: "statefulset without replicas",
+			obj: unstructured.Unstructured{
+				Object: map[string]interface{}{
+					"kind": "StatefulSet",
+					"spec": map[string]interface{}{},
+				},
+			},
+			want: unstructured.Unstructured{
+				Object: map[string]interface{}{
+					"kind": "StatefulSet",
+					"metadata": map[string]interface{}{
+						"annotations": map[string]interface{}{replicasAnnotation: ""},
+					},
+					"spec": map[string]interface{}{
+						"replicas": int64(0),
+					},
+				},
+			},
+		},
+		{
+			name: "already scaled down",
+			obj: unstructured.Unstructured{
+				Object: map[string]interface{}{
+					"kind": "Deployment",
+					"spec": map[string]interface{}{
+						"replicas": int64(0),
+					},
+				},
+			},
+			existing: unstructured.Unstructured{
+				Object: map[string]interface{}{
+					"kind": "Deployment",
+					"metadata": map[string]interface{}{
+						"annotations": map[string]interface{}{replicasAnnotation: "3"},
+					},
+				},
+			},
+			want: unstructured.Unstructured{
+				Object: map[string]interface{}{
+					"kind": "Deployment",
+					"metadata": map[string]interface{}{
+						"annotations": map[string]interface{}{replicasAnnotation: "3"},
+					},
+					"spec": map[string]interface{}{
+						"replicas": int64(0),
+					},
+				},
+			},
+		},
+		{
+			name: "service",
+			obj: unstructured.Unstructured{
+				Object: map[string]interface{}{
+					"kind": "Service",
+					"spec": map[string]interface{}{},
+				},
+			},
+			want: unstructured.Unstructured{
+				Object: map[string]interface{}{
+					"kind": "Service",
+					"spec": map[string]interface{}{},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := scaleDown(tt.obj, tt.existing); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("scaleDown() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestScaleUp applies a Deployment through a draft and ready_for_review like applyResource.
+func TestScaleUp(t *testing.T) {
+	newDeployment := func(replicas interface{}, annotations map[string]interface{}) unstructured.Unstructured {
+		metadata := map[string]interface{}{"name": "web"}
+		if annotations != nil {
+			metadata["annotations"] = annotations
+		}
+		spec := map[string]interface{}{"template": map[string]interface{}{}}
+		if replicas != nil {
+			spec["replicas"] = replicas
+		}
+		return unstructured.Unstructured{Object: map[string]interface{}{"kind": "Deployment", "metadata": metadata, "spec": spec}}
+	}
+	apply := func(rendered unstructured.Unstructured, existing unstructured.Unstructured, scaledDown bool) unstructured.Unstructured {
+		fields, err := ignoredFields(rendered)
+		if err != nil {
+			t.Fatal(err)
+		}
+		merged := restoreIgnoredFields(mergeResourceConfigs(rendered, existing), existing, fields)
+		if scaledDown {
+			return scaleDown(merged, existing)
+		}
+		return scaleUp(merged, rendered, existing, fields)
+	}
+	replicas := func(obj unstructured.Unstructured) interface{} {
+		v, _, _ := unstructured.NestedFieldNoCopy(obj.Object, "spec", "replicas")
+		return v
+	}
+
+	tests := []struct {
+		name     string
+		rendered unstructured.Unstructured
+		// existing is the resource before the draft. It's the rendered one on a creation.
+		existing unstructured.Unstructured
+		want     interface{}
+	}{
+		{name: "without replicas", rendered: newDeployment(nil, nil), existing: newDeployment(int64(1), nil), want: int64(1)},
+		{name: "created as a draft", rendered: newDeployment(nil, nil), existing: newDeployment(nil, nil), want: nil},
+		{name: "with replicas", rendered: newDeployment(int64(2), nil), existing: newDeployment(int64(2), nil), want: int64(2)},
+		{
+			name:     "ignored replicas",
+			rendered: newDeployment(int64(2), map[string]interface{}{ignoreFieldsAnnotation: "spec.replicas"}),
+			existing: newDeployment(int64(5), nil),
+			want:     int64(5),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			draft := apply(tt.rendered, tt.existing, true)
+			if replicas(draft) != int64(0) {
+				t.Fatalf("replicas = %v, want 0 for a draft", replicas(draft))
+			}
+			// Reconciled again while it's a draft.
+			draft = apply(tt.rendered, draft, true)
+			ready := apply(tt.rendered, draft, false)
+			if got := replicas(ready); got != tt.want {
+				t.Fatalf("replicas = %v, want %v after ready_for_review", got, tt.want)
+			}
+			if _, ok := ready.GetAnnotations()[replicasAnnotation]; ok {
+				t.Fatalf("annotations = %v, want the annotation removed", ready.GetAnnotations())
+			}
+		})
+	}
+}
@@ -0,0 +1,186 @@
+package controllers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	// updatePolicyAnnotation chooses how an existing resource is updated.
+	updatePolicyAnnotation = "kubetempura.mercari.com/update-policy"
+	// ignoreFieldsAnnotation is a comma-separated list of fields which are kept as they are in an existing resource. E.g. "spec.replicas,spec.template.spec.containers[0].image"
+	ignoreFieldsAnnotation = "kubetempura.mercari.com/ignore-fields"
+
+	// updatePolicyUpdate overwrites the existing resource with the rendered one. This is the default.
+	updatePolicyUpdate = "Update"
+	// updatePolicyCreateOnly creates the resource, but never updates it.
+	updatePolicyCreateOnly = "CreateOnly"
+	// updatePolicyRecreate deletes and creates the resource again when the update is rejected because of immutable fields.
+	updatePolicyRecreate = "Recreate"
+
+	// operationResultRecreating means the resource was deleted to be created again on the next reconcile.
+	operationResultRecreating controllerutil.OperationResult = "recreating"
+)
+
+func updatePolicy(resource unstructured.Unstructured) string {
+	switch p := resource.GetAnnotations()[updatePolicyAnnotation]; p {
+	case updatePolicyCreateOnly, updatePolicyRecreate:
+		return p
+	default:
+		return updatePolicyUpdate
+	}
+}
+
+// ignoredFields returns the fields listed in the annotation. Each field is split into the keys of a path. See parseField.
+// The invalid fields are returned in the error, and the others are still returned.
+func ignoredFields(resource unstructured.Unstructured) ([][]string, error) {
+	var ret [][]string
+	var errs []error
+	for _, f := range strings.Split(resource.GetAnnotations()[ignoreFieldsAnnotation], ",") {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		path, err := parseField(f)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		ret = append(ret, path)
+	}
+	return ret, utilerrors.NewAggregate(errs)
+}
+
+// parseField splits a field into the keys of the maps and the indexes of the lists. E.g. spec.containers[0].image is spec, containers, [0] and image.
+func parseField(field string) ([]string, error) {
+	var path []string
+	for _, segment := range strings.Split(field, ".") {
+		key, rest := segment, ""
+		if i := strings.Index(segment, "["); i >= 0 {
+			key, rest = segment[:i], segment[i:]
+		}
+		if key == "" || strings.Contains(key, "]") {
+			return nil, fmt.Errorf("invalid field %q: a key must not be empty", field)
+		}
+		path = append(path, key)
+		for rest != "" {
+			end := strings.Index(rest, "]")
+			if !strings.HasPrefix(rest, "[") || end < 0 {
+				return nil, fmt.Errorf("invalid field %q: an index must be in brackets", field)
+			}
+			index, err := strconv.Atoi(rest[1:end])
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("invalid field %q: %q is not an index", field, rest[1:end])
+			}
+			path = append(path, fmt.Sprintf("[%d]", index))
+			rest = rest[end+1:]
+		}
+	}
+	return path, nil
+}
+
+// fieldIndex returns the index of a list when the key of a path is in brackets.
+func fieldIndex(key string) (int, bool) {
+	if !strings.HasPrefix(key, "[") || !strings.HasSuffix(key, "]") {
+		return 0, false
+	}
+	index, err := strconv.Atoi(key[1 : len(key)-1])
+	return index, err == nil
+}
+
+func isIgnoredField(fields [][]string, path ...string) bool {
+	for _, f := range fields {
+		if strings.Join(f, ".") == strings.Join(path, ".") {
+			return true
+		}
+	}
+	return false
+}
+
+// restoreIgnoredFields keeps the values of the ignored fields of the existing resource.
+// A field which doesn't exist in the existing resource (e.g. when it's created) takes the rendered value.
+// An element of a list is restored only when the list of the merged resource has the element.
+func restoreIgnoredFields(merged unstructured.Unstructured, existing unstructured.Unstructured, fields [][]string) unstructured.Unstructured {
+	n := *merged.DeepCopy()
+	for _, f := range fields {
+		v, ok := nestedField(existing.Object, f)
+		if !ok {
+			continue
+		}
+		// The maps created on the way are discarded when the field can't be set.
+		obj := runtime.DeepCopyJSON(n.Object)
+		if setNestedField(obj, runtime.DeepCopyJSONValue(v), f) {
+			n.Object = obj
+		}
+	}
+	return n
+}
+
+// nestedField returns the value of the path in the object. It returns false when the path doesn't exist.
+func nestedField(obj map[string]interface{}, path []string) (interface{}, bool) {
+	var cur interface{} = obj
+	for _, key := range path {
+		if index, ok := fieldIndex(key); ok {
+			l, ok := cur.([]interface{})
+			if !ok || index >= len(l) {
+				return nil, false
+			}
+			cur = l[index]
+			continue
+		}
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if cur, ok = m[key]; !ok {
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+// setNestedField sets the value of the path in the object. The missing maps are created, but a missing list or element isn't.
+// It returns false when the value can't be set.
+func setNestedField(obj map[string]interface{}, value interface{}, path []string) bool {
+	var cur interface{} = obj
+	for i, key := range path {
+		last := i == len(path)-1
+		if index, ok := fieldIndex(key); ok {
+			l, ok := cur.([]interface{})
+			if !ok || index >= len(l) {
+				return false
+			}
+			if last {
+				l[index] = value
+				return true
+			}
+			cur = l[index]
+			continue
+		}
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		if last {
+			m[key] = value
+			return true
+		}
+		if next, ok := m[key]; ok && next != nil {
+			cur = next
+			continue
+		}
+		if _, ok := fieldIndex(path[i+1]); ok {
+			return false
+		}
+		next := map[string]interface{}{}
+		m[key] = next
+		cur = next
+	}
+	return false
+}
@@ -0,0 +1,203 @@
+package controllers
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestUpdatePolicy(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        string
+	}{
+		{
+			name: "default",
+			want: updatePolicyUpdate,
+		},
+		{
+			name:        "create only",
+			annotations: map[string]string{updatePolicyAnnotation: "CreateOnly"},
+			want:        updatePolicyCreateOnly,
+		},
+		{
+			name:        "recreate",
+			annotations: map[string]string{updatePolicyAnnotation: "Recreate"},
+			want:        updatePolicyRecreate,
+		},
+		{
+			name:        "unknown",
+			annotations: map[string]string{updatePolicyAnnotation: "Foo"},
+			want:        updatePolicyUpdate,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resource := unstructured.Unstructured{Object: map[string]interface{}{}}
+			resource.SetAnnotations(tt.annotations)
+			if got := updatePolicy(resource); got != tt.want {
+				t.Fatalf("updatePolicy() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRestoreIgnoredFields(t *testing.T) {
+	rendered := unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata": map[string]interface{}{
+				"name": "foo-11",
+				"annotations": map[string]interface{}{
+					ignoreFieldsAnnotation: "spec.replicas, spec.template.metadata.annotations",
+				},
+			},
+			"spec": map[string]interface{}{
+				"replicas": int64(1),
+				"template": map[string]interface{}{
+					"metadata": map[string]interface{}{},
+					"spec": map[string]interface{}{
+						"serviceAccountName": "foo",
+					},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		existing unstructured.Unstructured
+		want     unstructured.Unstructured
+	}{
+		{
+			name: "create",
+			existing: unstructured.Unstructured{
+				Object: map[string]interface{}{
+					"apiVersion": "apps/v1",
+					"kind":       "Deployment",
+					"metadata": map[string]interface{}{
+						"name": "foo-11",
+					},
+				},
+			},
+			want: rendered,
+		},
+		{
+			name: "keep the existing values",
+			existing: unstructured.Unstructured{
+				Object: map[string]interface{}{
+					"apiVersion": "apps/v1",
+					"kind":       "Deployment",
+					"metadata": map[string]interface{}{
+						"name": "foo-11",
+					},
+					"spec": map[string]interface{}{
+						"replicas": int64(5),
+						"template": map[string]interface{}{
+							"metadata": map[string]interface{}{
+								"annotations": map[string]interface{}{
+									"kubectl.kubernetes.io/restartedAt": "2021-12-16T01:40:49Z",
+								},
+							},
+							"spec": map[string]interface{}{
+								"serviceAccountName": "bar",
+							},
+						},
+					},
+				},
+			},
+			want: unstructured.Unstructured{
+				Object: map[string]interface{}{
+					"apiVersion": "apps/v1",
+					"kind":       "Deployment",
+					"metadata": map[string]interface{}{
+						"name": "foo-11",
+						"annotations": map[string]interface{}{
+							ignoreFieldsAnnotation: "spec.replicas, spec.template.metadata.annotations",
+						},
+					},
+					"spec": map[string]interface{}{
+						"replicas": int64(5),
+						"template": map[string]interface{}{
+							"metadata": map[string]interface{}{
+								"annotations": map[string]interface{}{
+									"kubectl.kubernetes.io/restartedAt": "2021-12-16T01:40:49Z",
+								},
+							},
+							"spec": map[string]interface{}{
+								"serviceAccountName": "foo",
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged := mergeResourceConfigs(rendered, tt.existing)
+			fields, err := ignoredFields(rendered)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := restoreIgnoredFields(merged, tt.existing, fields); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("restoreIgnoredFields() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIgnoredFields(t *testing.T) {
+	resource := unstructured.Unstructured{}
+	resource.SetAnnotations(map[string]string{
+		ignoreFieldsAnnotation: "spec.replicas, spec.template.spec.containers[0].image, spec..replicas, spec.containers[a], metadata.annotations, spec.ports[1][00]",
+	})
+	got, err := ignoredFields(resource)
+	want := [][]string{
+		{"spec", "replicas"},
+		{"spec", "template", "spec", "containers", "[0]", "image"},
+		{"metadata", "annotations"},
+		{"spec", "ports", "[1]", "[0]"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("ignoredFields() = %v, want %v", got, want)
+	}
+	// The invalid fields are reported instead of being dropped silently.
+	if err == nil || !strings.Contains(err.Error(), "spec..replicas") || !strings.Contains(err.Error(), "spec.containers[a]") {
+		t.Fatalf("ignoredFields() error = %v, want the invalid fields", err)
+	}
+}
+
+func TestRestoreIgnoredFieldsOfList(t *testing.T) {
+	newDeployment := func(images ...string) unstructured.Unstructured {
+		var containers []interface{}
+		for _, image := range images {
+			containers = append(containers, map[string]interface{}{"name": "app", "image": image})
+		}
+		return unstructured.Unstructured{Object: map[string]interface{}{
+			"kind": "Deployment",
+			"spec": map[string]interface{}{
+				"template": map[string]interface{}{
+					"spec": map[string]interface{}{"containers": containers},
+				},
+			},
+		}}
+	}
+	fields := [][]string{{"spec", "template", "spec", "containers", "[0]", "image"}, {"spec", "template", "spec", "containers", "[1]", "image"}}
+
+	// The second container isn't in the merged resource, so it isn't restored.
+	got := restoreIgnoredFields(newDeployment("rendered"), newDeployment("existing", "sidecar"), fields)
+	if want := newDeployment("existing"); !reflect.DeepEqual(got, want) {
+		t.Fatalf("restoreIgnoredFields() = %v, want %v", got, want)
+	}
+	got = restoreIgnoredFields(newDeployment("rendered"), unstructured.Unstructured{Object: map[string]interface{}{"kind": "Deployment"}}, fields)
+	if want := newDeployment("rendered"); !reflect.DeepEqual(got, want) {
+		t.Fatalf("restoreIgnoredFields() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,132 @@
+package github
+
+import (
+	"context"
+	"strings"
+
+	kubetempurav1 "github.com/mercari/kubetempura/api/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// teamMembers tells whether a user is a member of a team. *Client implements it for GitHub.
+type teamMembers interface {
+	IsTeamMember(ctx context.Context, org string, teamSlug string, login string) (bool, error)
+}
+
+// isAllowed returns true when the author and the fork policy of the ReviewApp allow the pull request.
+func isAllowed(ctx context.Context, reviewApp kubetempurav1.ReviewApp, pr pullRequest, members teamMembers) (bool, error) {
+	allowed, err := isAllowedAuthor(ctx, reviewApp, pr, members)
+	if err != nil || !allowed {
+		return false, err
+	}
+	return isAllowedFork(ctx, reviewApp, pr, members)
+}
+
+// hasAuthorFilter returns true when the ReviewApp filters the pull request by its author.
+func hasAuthorFilter(reviewApp kubetempurav1.ReviewApp, pr pullRequest) bool {
+	authors := reviewApp.Spec.Authors
+	if len(authors.Allow.Users) != 0 || len(authors.Allow.Teams) != 0 || len(authors.Deny.Users) != 0 || len(authors.Deny.Teams) != 0 {
+		return true
+	}
+	return pr.fork && reviewApp.Spec.ForkPolicy.Mode == kubetempurav1.ForkPolicyAllowlist
+}
+
+// isAllowedAuthor returns true when the author matches the allowed users (if any), and doesn't match the denied ones.
+func isAllowedAuthor(ctx context.Context, reviewApp kubetempurav1.ReviewApp, pr pullRequest, members teamMembers) (bool, error) {
+	authors := reviewApp.Spec.Authors
+	denied, err := matchUser(ctx, authors.Deny, pr.author, members)
+	if err != nil || denied {
+		return false, err
+	}
+	if len(authors.Allow.Users) == 0 && len(authors.Allow.Teams) == 0 {
+		return true, nil
+	}
+	return matchUser(ctx, authors.Allow, pr.author, members)
+}
+
+// isAllowedFork returns true when the pull request isn't from a fork, or the fork policy of the ReviewApp allows it.
+func isAllowedFork(ctx context.Context, reviewApp kubetempurav1.ReviewApp, pr pullRequest, members teamMembers) (bool, error) {
+	if !pr.fork {
+		return true, nil
+	}
+	policy := reviewApp.Spec.ForkPolicy
+	switch policy.Mode {
+	case kubetempurav1.ForkPolicyIgnore:
+		return false, nil
+	case kubetempurav1.ForkPolicyRequireLabel:
+		return policy.ApprovalLabel != "" && pr.hasLabel(policy.ApprovalLabel), nil
+	case kubetempurav1.ForkPolicyAllowlist:
+		return matchUser(ctx, policy.Allowlist, pr.author, members)
+	default:
+		return true, nil
+	}
+}
+
+// approvedCommit returns the head commit of the pull request from a fork when the event adds the approval label of the ReviewApp.
+func approvedCommit(reviewApp kubetempurav1.ReviewApp, pr pullRequest) string {
+	policy := reviewApp.Spec.ForkPolicy
+	if !pr.fork || policy.Mode != kubetempurav1.ForkPolicyRequireLabel || policy.ApprovalLabel == "" {
+		return ""
+	}
+	for _, label := range pr.addedLabels {
+		if label == policy.ApprovalLabel {
+			return pr.headSHA
+		}
+	}
+	return ""
+}
+
+// waitingForApproval returns true when the head commit of the pull request from a fork isn't the one approved by the approval label.
+// The label stays on the pull request, so the commits pushed after it are deployed only when the label is added again.
+func waitingForApproval(ctx context.Context, reviewApp kubetempurav1.ReviewApp, pr pullRequest, c client.Client) (bool, error) {
+	if !pr.fork || reviewApp.Spec.ForkPolicy.Mode != kubetempurav1.ForkPolicyRequireLabel || approvedCommit(reviewApp, pr) != "" {
+		return false, nil
+	}
+	prs, err := findPRs(ctx, reviewApp, pr.repositoryID(), pr.number, c)
+	if err != nil {
+		return false, err
+	}
+	for _, existing := range prs {
+		if existing.Spec.ApprovedCommitRef == pr.headSHA {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// matchUser returns true when the user is in the users or a member of the teams of the filter.
+func matchUser(ctx context.Context, filter kubetempurav1.UserFilter, login string, members teamMembers) (bool, error) {
+	for _, user := range filter.Users {
+		// Logins are case-insensitive.
+		if strings.EqualFold(user, login) {
+			return true, nil
+		}
+	}
+	if members == nil {
+		// The provider has no teams.
+		return false, nil
+	}
+	for _, team := range filter.Teams {
+		org, slug, ok := splitTeam(team)
+		if !ok {
+			log.Info("Invalid team. It must be ORG/TEAM_SLUG", "team", team)
+			continue
+		}
+		member, err := members.IsTeamMember(ctx, org, slug, login)
+		if err != nil {
+			return false, err
+		}
+		if member {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func splitTeam(team string) (string, string, bool) {
+	i := strings.Index(team, "/")
+	if i <= 0 || i == len(team)-1 {
+		return "", "", false
+	}
+	return team[:i], team[i+1:], true
+}
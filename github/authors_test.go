@@ -0,0 +1,232 @@
+package github
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	kubetempurav1 "github.com/mercari/kubetempura/api/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// newFakeTeamsServer serves the memberships of the teams. E.g. {"mercari/backend": {"octocat"}}
+func newFakeTeamsServer(t *testing.T, teams map[string][]string) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	for team, members := range teams {
+		org, slug, _ := splitTeam(team)
+		for _, member := range members {
+			mux.HandleFunc("/orgs/"+org+"/teams/"+slug+"/memberships/"+member, func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte(`{"state":"active"}`))
+			})
+		}
+	}
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestIsAllowedFork(t *testing.T) {
+	server := newFakeTeamsServer(t, map[string][]string{"mercari/backend": {"octocat"}})
+	gh := NewClient(server.URL, "")
+
+	tests := []struct {
+		name   string
+		policy kubetempurav1.ForkPolicy
+		pr     pullRequest
+		want   bool
+	}{
+		{
+			name:   "not a fork",
+			policy: kubetempurav1.ForkPolicy{Mode: kubetempurav1.ForkPolicyIgnore},
+			pr:     pullRequest{number: "1", author: "someone"},
+			want:   true,
+		},
+		{
+			name: "fork with the default policy",
+			pr:   pullRequest{number: "1", fork: true, author: "someone"},
+			want: true,
+		},
+		{
+			name:   "fork with Ignore",
+			policy: kubetempurav1.ForkPolicy{Mode: kubetempurav1.ForkPolicyIgnore},
+			pr:     pullRequest{number: "1", fork: true, author: "someone"},
+			want:   false,
+		},
+		{
+			name:   "approved fork",
+			policy: kubetempurav1.ForkPolicy{Mode: kubetempurav1.ForkPolicyRequireLabel, ApprovalLabel: "safe-to-deploy"},
+			pr:     pullRequest{number: "1", fork: true, author: "someone", labels: []string{"safe-to-deploy"}},
+			want:   true,
+		},
+		{
+			name:   "not approved fork",
+			policy: kubetempurav1.ForkPolicy{Mode: kubetempurav1.ForkPolicyRequireLabel, ApprovalLabel: "safe-to-deploy"},
+			pr:     pullRequest{number: "1", fork: true, author: "someone"},
+			want:   false,
+		},
+		{
+			name:   "allowed user",
+			policy: kubetempurav1.ForkPolicy{Mode: kubetempurav1.ForkPolicyAllowlist, Allowlist: kubetempurav1.UserFilter{Users: []string{"Someone"}}},
+			pr:     pullRequest{number: "1", fork: true, author: "someone"},
+			want:   true,
+		},
+		{
+			name:   "member of an allowed team",
+			policy: kubetempurav1.ForkPolicy{Mode: kubetempurav1.ForkPolicyAllowlist, Allowlist: kubetempurav1.UserFilter{Teams: []string{"mercari/backend"}}},
+			pr:     pullRequest{number: "1", fork: true, author: "octocat"},
+			want:   true,
+		},
+		{
+			name:   "not allowed",
+			policy: kubetempurav1.ForkPolicy{Mode: kubetempurav1.ForkPolicyAllowlist, Allowlist: kubetempurav1.UserFilter{Users: []string{"octocat"}, Teams: []string{"mercari/backend"}}},
+			pr:     pullRequest{number: "1", fork: true, author: "someone"},
+			want:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reviewApp := kubetempurav1.ReviewApp{Spec: kubetempurav1.ReviewAppSpec{ForkPolicy: tt.policy}}
+			got, err := isAllowedFork(context.Background(), reviewApp, tt.pr, gh)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("isAllowedFork() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsAllowedAuthor(t *testing.T) {
+	server := newFakeTeamsServer(t, map[string][]string{"mercari/backend": {"octocat"}, "mercari/bots": {"renovate[bot]"}})
+	gh := NewClient(server.URL, "")
+
+	tests := []struct {
+		name    string
+		authors kubetempurav1.AuthorFilter
+		author  string
+		want    bool
+	}{
+		{
+			name:   "no filters",
+			author: "someone",
+			want:   true,
+		},
+		{
+			name:    "denied user",
+			authors: kubetempurav1.AuthorFilter{Deny: kubetempurav1.UserFilter{Users: []string{"dependabot[bot]"}}},
+			author:  "dependabot[bot]",
+			want:    false,
+		},
+		{
+			name:    "member of a denied team",
+			authors: kubetempurav1.AuthorFilter{Deny: kubetempurav1.UserFilter{Teams: []string{"mercari/bots"}}},
+			author:  "renovate[bot]",
+			want:    false,
+		},
+		{
+			name:    "member of an allowed team",
+			authors: kubetempurav1.AuthorFilter{Allow: kubetempurav1.UserFilter{Teams: []string{"mercari/backend"}}},
+			author:  "octocat",
+			want:    true,
+		},
+		{
+			name:    "not allowed",
+			authors: kubetempurav1.AuthorFilter{Allow: kubetempurav1.UserFilter{Teams: []string{"mercari/backend"}}},
+			author:  "someone",
+			want:    false,
+		},
+		{
+			name: "allowed but denied",
+			authors: kubetempurav1.AuthorFilter{
+				Allow: kubetempurav1.UserFilter{Teams: []string{"mercari/backend"}},
+				Deny:  kubetempurav1.UserFilter{Users: []string{"octocat"}},
+			},
+			author: "octocat",
+			want:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reviewApp := kubetempurav1.ReviewApp{Spec: kubetempurav1.ReviewAppSpec{Authors: tt.authors}}
+			got, err := isAllowedAuthor(context.Background(), reviewApp, pullRequest{number: "1", author: tt.author}, gh)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("isAllowedAuthor() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("API error", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer server.Close()
+		reviewApp := kubetempurav1.ReviewApp{Spec: kubetempurav1.ReviewAppSpec{Authors: kubetempurav1.AuthorFilter{Allow: kubetempurav1.UserFilter{Teams: []string{"mercari/backend"}}}}}
+		if _, err := isAllowedAuthor(context.Background(), reviewApp, pullRequest{number: "1", author: "octocat"}, NewClient(server.URL, "")); err == nil {
+			t.Fatal("isAllowedAuthor() must return the error")
+		}
+	})
+}
+
+func TestHandlePullRequestForkApproval(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"number": 1, "state": "open"}`))
+	}))
+	defer server.Close()
+
+	web := &kubetempurav1.ReviewApp{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+		Spec: kubetempurav1.ReviewAppSpec{
+			GithubRepository: "https://github.com/mercari/kubetempura",
+			ForkPolicy:       kubetempurav1.ForkPolicy{Mode: kubetempurav1.ForkPolicyRequireLabel, ApprovalLabel: "safe-to-deploy"},
+		},
+	}
+	c := newFakeClient(t, web)
+	p, err := newGitHubProvider(NewClient(server.URL, ""), WebhookOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	updatedAt := time.Date(2021, 7, 1, 0, 0, 0, 0, time.UTC)
+	handle := func(sha string, addedLabels []string) string {
+		t.Helper()
+		updatedAt = updatedAt.Add(time.Minute)
+		e := &pullRequestEvent{
+			repository: "https://github.com/mercari/kubetempura",
+			pullRequest: pullRequest{number: "1", headSHA: sha, fork: true, labels: []string{"safe-to-deploy"}, addedLabels: addedLabels,
+				updatedAt: updatedAt, repository: "mercari/kubetempura"},
+		}
+		if err := handlePullRequest(context.Background(), p, e, "", c); err != nil {
+			t.Fatal(err)
+		}
+		prs, err := findPRs(context.Background(), *web, "mercari/kubetempura", "1", c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(prs) == 0 {
+			return ""
+		}
+		return prs[0].Spec.HeadCommitRef
+	}
+
+	if got := handle("first", nil); got != "" {
+		t.Fatalf("HeadCommitRef = %q, a commit must not be deployed before the label is added", got)
+	}
+	if got := handle("first", []string{"safe-to-deploy"}); got != "first" {
+		t.Fatalf("HeadCommitRef = %q, want the labeled commit", got)
+	}
+	// The fork pushes again. The label is still on the pull request.
+	if got := handle("second", nil); got != "first" {
+		t.Fatalf("HeadCommitRef = %q, a commit pushed after the label must not be deployed", got)
+	}
+	if got := handle("second", []string{"safe-to-deploy"}); got != "second" {
+		t.Fatalf("HeadCommitRef = %q, want the commit labeled again", got)
+	}
+}
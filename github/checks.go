@@ -0,0 +1,190 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	kubetempurav1 "github.com/mercari/kubetempura/api/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	checkRunEvent    = "check_run"
+	workflowRunEvent = "workflow_run"
+)
+
+// checkResult is a check run or a workflow run which succeeded for a commit.
+type checkResult struct {
+	name    string
+	headSHA string
+	// numbers are the pull requests of the commit. The payload doesn't have the pull requests from forks.
+	numbers []string
+}
+
+// checker is implemented by a provider which reads the checks of the commits, so the deploys wait for the required checks.
+type checker interface {
+	// checkPassed returns true when the check of the name succeeded for the head commit of the pull request.
+	checkPassed(ctx context.Context, e *pullRequestEvent, name string) (bool, error)
+	// getPullRequestEvent returns the current state of the pull request, because the payload of a check doesn't have it.
+	getPullRequestEvent(ctx context.Context, e *pullRequestEvent) (*pullRequestEvent, error)
+}
+
+// githubCheckPayload is the part of the payload of a check_run or workflow_run event used by KubeTempura.
+type githubCheckPayload struct {
+	Action      string     `json:"action"`
+	CheckRun    *githubRun `json:"check_run"`
+	WorkflowRun *githubRun `json:"workflow_run"`
+	Repository  struct {
+		HTMLURL  string `json:"html_url"`
+		FullName string `json:"full_name"`
+	} `json:"repository"`
+}
+
+type githubRun struct {
+	Name         string `json:"name"`
+	HeadSHA      string `json:"head_sha"`
+	Conclusion   string `json:"conclusion"`
+	PullRequests []struct {
+		Number int64 `json:"number"`
+	} `json:"pull_requests"`
+}
+
+// newCheckEvent returns the event of a successful check run or workflow run. It returns errIgnoredEvent for the others.
+func newCheckEvent(event string, body []byte) (*pullRequestEvent, error) {
+	var payload githubCheckPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, err
+	}
+	run := payload.CheckRun
+	if event == workflowRunEvent {
+		run = payload.WorkflowRun
+	}
+	if payload.Action != "completed" || run == nil || run.Conclusion != "success" || len(run.PullRequests) == 0 {
+		return nil, errIgnoredEvent
+	}
+	check := &checkResult{name: run.Name, headSHA: run.HeadSHA}
+	for _, pr := range run.PullRequests {
+		check.numbers = append(check.numbers, strconv.FormatInt(pr.Number, 10))
+	}
+	return &pullRequestEvent{
+		repository:  payload.Repository.HTMLURL,
+		pullRequest: pullRequest{repository: payload.Repository.FullName, host: repositoryHost(payload.Repository.HTMLURL)},
+		check:       check,
+	}, nil
+}
+
+// handleCheck deploys the head commit of the pull requests of the successful check.
+// Only the ReviewApps in the namespace handle the check. An empty namespace means all namespaces.
+func handleCheck(ctx context.Context, p provider, e *pullRequestEvent, namespace string, c client.Client) error {
+	chk, ok := p.(checker)
+	if !ok {
+		return nil
+	}
+	reviewApps, err := findReviewAppsOfEvent(ctx, c, p, e, namespace)
+	if err != nil {
+		return err
+	}
+	if !requiresCheck(reviewApps, e.check.name) {
+		// Most checks aren't required by any ReviewApp. They don't need to read the pull requests.
+		return nil
+	}
+	var errs []error
+	for _, number := range e.check.numbers {
+		current, err := chk.getPullRequestEvent(ctx, &pullRequestEvent{
+			repository:  e.repository,
+			pullRequest: pullRequest{number: number, repository: e.pullRequest.repository, host: e.pullRequest.host},
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to get the pull request %s: %w", number, err))
+			continue
+		}
+		if current.closed || current.pullRequest.headSHA != e.check.headSHA {
+			// A newer commit is deployed by its own check.
+			log.Info("Ignored the check of an outdated commit", "check", e.check.name, "prNumber", number, "sha", e.check.headSHA)
+			continue
+		}
+		current.check = e.check
+		current.sharedEndpoint = e.sharedEndpoint
+		if err := handlePullRequest(ctx, p, current, namespace, c); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+func requiresCheck(reviewApps []kubetempurav1.ReviewApp, name string) bool {
+	for _, reviewApp := range reviewApps {
+		if reviewApp.Spec.RequiredCheck == name {
+			return true
+		}
+	}
+	return false
+}
+
+// checkPassed returns true when the ReviewApp can deploy the head commit of the pull request.
+// A provider which can't read the checks doesn't wait for them.
+func checkPassed(ctx context.Context, p provider, e *pullRequestEvent, reviewApp kubetempurav1.ReviewApp) (bool, error) {
+	name := reviewApp.Spec.RequiredCheck
+	if name == "" {
+		return true, nil
+	}
+	if e.check != nil && e.check.name == name && e.check.headSHA == e.pullRequest.headSHA {
+		return true, nil
+	}
+	chk, ok := p.(checker)
+	if !ok {
+		return true, nil
+	}
+	return chk.checkPassed(ctx, e, name)
+}
+
+// prWaiting updates the PRs of the ReviewApps except the commit, which is deployed later. E.g. after the required check succeeds.
+// A PR isn't created until then.
+func prWaiting(ctx context.Context, reviewApps []kubetempurav1.ReviewApp, pullRequest pullRequest, c client.Client) error {
+	var errs []error
+	for _, reviewApp := range reviewApps {
+		deployed, ok, err := deployedPullRequest(ctx, reviewApp, pullRequest, c)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to find the PR of %s: %w", reviewApp.Name, err))
+			continue
+		}
+		if !ok {
+			continue
+		}
+		err = updatePRWithRetry(ctx, reviewApp, deployed, c, nil)
+		if err == errStaleEvent {
+			log.Info("Ignored an older event", "reviewApp", reviewApp.Name, "prNumber", pullRequest.number)
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to update the PR of %s: %w", reviewApp.Name, err))
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// deployablePullRequest returns the pull request with the commit the ReviewApp can deploy.
+// It's the deployed commit until the required check of the head commit succeeds, and false is returned when nothing is deployed yet.
+func deployablePullRequest(ctx context.Context, p provider, e *pullRequestEvent, reviewApp kubetempurav1.ReviewApp, c client.Client) (pullRequest, bool, error) {
+	passed, err := checkPassed(ctx, p, e, reviewApp)
+	if err != nil {
+		return pullRequest{}, false, fmt.Errorf("failed to read the check %s: %w", reviewApp.Spec.RequiredCheck, err)
+	}
+	if passed {
+		return e.pullRequest, true, nil
+	}
+	return deployedPullRequest(ctx, reviewApp, e.pullRequest, c)
+}
+
+// deployedPullRequest returns the pull request with the commit of the PR of the ReviewApp. It returns false when there's no PR.
+func deployedPullRequest(ctx context.Context, reviewApp kubetempurav1.ReviewApp, pullRequest pullRequest, c client.Client) (pullRequest, bool, error) {
+	prs, err := findPRs(ctx, reviewApp, pullRequest.repositoryID(), pullRequest.number, c)
+	if err != nil || len(prs) == 0 {
+		return pullRequest, false, err
+	}
+	pullRequest.headSHA = prs[0].Spec.HeadCommitRef
+	return pullRequest, true, nil
+}
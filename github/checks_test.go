@@ -0,0 +1,173 @@
+package github
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	kubetempurav1 "github.com/mercari/kubetempura/api/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNewCheckEvent(t *testing.T) {
+	tests := []struct {
+		name    string
+		event   string
+		payload string
+		want    *checkResult
+	}{
+		{
+			name:    "check run",
+			event:   checkRunEvent,
+			payload: `{"action": "completed", "check_run": {"name": "build", "head_sha": "abcdefg", "conclusion": "success", "pull_requests": [{"number": 1}, {"number": 2}]}, "repository": {"html_url": "https://github.com/mercari/kubetempura", "full_name": "mercari/kubetempura"}}`,
+			want:    &checkResult{name: "build", headSHA: "abcdefg", numbers: []string{"1", "2"}},
+		},
+		{
+			name:    "workflow run",
+			event:   workflowRunEvent,
+			payload: `{"action": "completed", "workflow_run": {"name": "Build", "head_sha": "abcdefg", "conclusion": "success", "pull_requests": [{"number": 1}]}, "repository": {"html_url": "https://github.com/mercari/kubetempura", "full_name": "mercari/kubetempura"}}`,
+			want:    &checkResult{name: "Build", headSHA: "abcdefg", numbers: []string{"1"}},
+		},
+		{
+			name:    "failure",
+			event:   checkRunEvent,
+			payload: `{"action": "completed", "check_run": {"name": "build", "head_sha": "abcdefg", "conclusion": "failure", "pull_requests": [{"number": 1}]}}`,
+		},
+		{
+			name:    "in progress",
+			event:   workflowRunEvent,
+			payload: `{"action": "requested", "workflow_run": {"name": "Build", "head_sha": "abcdefg", "pull_requests": [{"number": 1}]}}`,
+		},
+		{
+			name:    "no pull requests",
+			event:   checkRunEvent,
+			payload: `{"action": "completed", "check_run": {"name": "build", "head_sha": "abcdefg", "conclusion": "success", "pull_requests": []}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newCheckEvent(tt.event, []byte(tt.payload))
+			if tt.want == nil {
+				if err != errIgnoredEvent {
+					t.Fatalf("newCheckEvent() = %v, %v, want errIgnoredEvent", got, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got.check, tt.want) || got.pullRequest.repository != "mercari/kubetempura" {
+				t.Fatalf("newCheckEvent() = %+v, %+v, want %+v", got, got.check, tt.want)
+			}
+		})
+	}
+}
+
+// fakeChecksAPI serves the pull request 1 with the head commit newsha. The workflow Build succeeded only for oldsha.
+func fakeChecksAPI(t *testing.T) (*httptest.Server, func() int) {
+	var mu sync.Mutex
+	pulls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/mercari/kubetempura/pulls/1":
+			mu.Lock()
+			pulls++
+			mu.Unlock()
+			_, _ = w.Write([]byte(`{"number": 1, "state": "open", "head": {"sha": "newsha"}, "updated_at": "2021-07-02T00:00:00Z"}`))
+		case "/repos/mercari/kubetempura/commits/oldsha/check-runs", "/repos/mercari/kubetempura/commits/newsha/check-runs":
+			_, _ = w.Write([]byte(`{"check_runs": []}`))
+		case "/repos/mercari/kubetempura/actions/runs":
+			if r.URL.Query().Get("head_sha") == "oldsha" {
+				_, _ = w.Write([]byte(`{"workflow_runs": [{"name": "Build", "status": "completed", "conclusion": "failure"}, {"name": "Build", "status": "completed", "conclusion": "success"}]}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"workflow_runs": [{"name": "Build", "status": "in_progress"}]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	return server, func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return pulls
+	}
+}
+
+func TestHandleCheck(t *testing.T) {
+	server, pulls := fakeChecksAPI(t)
+	defer server.Close()
+
+	web := &kubetempurav1.ReviewApp{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+		Spec:       kubetempurav1.ReviewAppSpec{GithubRepository: "https://github.com/mercari/kubetempura", RequiredCheck: "Build"},
+	}
+	c := newFakeClient(t, web)
+	p, err := newGitHubProvider(NewClient(server.URL, ""), WebhookOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	headCommitRef := func() string {
+		t.Helper()
+		prs, err := findPRs(context.Background(), *web, "mercari/kubetempura", "1", c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(prs) == 0 {
+			return ""
+		}
+		return prs[0].Spec.HeadCommitRef
+	}
+	synchronize := func(sha string, updatedAt time.Time) {
+		t.Helper()
+		e := &pullRequestEvent{
+			repository:  "https://github.com/mercari/kubetempura",
+			pullRequest: pullRequest{number: "1", headSHA: sha, updatedAt: updatedAt, repository: "mercari/kubetempura"},
+		}
+		if err := handlePullRequest(context.Background(), p, e, "", c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The PR isn't created until a commit passes the check.
+	synchronize("newsha", time.Date(2021, 7, 1, 0, 0, 0, 0, time.UTC))
+	if got := headCommitRef(); got != "" {
+		t.Fatalf("HeadCommitRef = %q, want no PR", got)
+	}
+	synchronize("oldsha", time.Date(2021, 7, 1, 0, 0, 0, 0, time.UTC))
+	if got := headCommitRef(); got != "oldsha" {
+		t.Fatalf("HeadCommitRef = %q, want oldsha which passed the check", got)
+	}
+	synchronize("newsha", time.Date(2021, 7, 1, 0, 1, 0, 0, time.UTC))
+	if got := headCommitRef(); got != "oldsha" {
+		t.Fatalf("HeadCommitRef = %q, want oldsha until the check of newsha succeeds", got)
+	}
+
+	check := func(name string, sha string) {
+		t.Helper()
+		e := &pullRequestEvent{
+			repository:  "https://github.com/mercari/kubetempura",
+			pullRequest: pullRequest{repository: "mercari/kubetempura"},
+			check:       &checkResult{name: name, headSHA: sha, numbers: []string{"1"}},
+		}
+		if err := handleCheck(context.Background(), p, e, "", c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	read := pulls()
+	check("Lint", "newsha")
+	if pulls() != read {
+		t.Fatalf("pulls = %d, a check not required by the ReviewApps must not read the pull request", pulls()-read)
+	}
+	check("Build", "oldsha")
+	if got := headCommitRef(); got != "oldsha" {
+		t.Fatalf("HeadCommitRef = %q, the check of an outdated commit must be ignored", got)
+	}
+	check("Build", "newsha")
+	if got := headCommitRef(); got != "newsha" {
+		t.Fatalf("HeadCommitRef = %q, want newsha which passed the check", got)
+	}
+}
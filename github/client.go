@@ -0,0 +1,236 @@
+package github
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/go-playground/webhooks/v6/github"
+)
+
+const (
+	// DefaultAPIURL is the URL of the GitHub REST API. GitHub Enterprise Server has it at https://HOSTNAME/api/v3/
+	DefaultAPIURL = "https://api.github.com/"
+
+	perPage = 100
+)
+
+// Client is a client of the GitHub REST API.
+type Client struct {
+	// BaseURL is the URL of the API. E.g. DefaultAPIURL, or a local server for tests.
+	BaseURL string
+	// Token is a personal access token or an installation token. It's optional for public repositories.
+	Token string
+
+	HTTPClient *http.Client
+}
+
+func NewClient(baseURL string, token string) *Client {
+	return &Client{
+		BaseURL:    baseURL,
+		Token:      token,
+		HTTPClient: http.DefaultClient,
+	}
+}
+
+// ListPullRequestFiles returns the paths of the files changed in the pull request.
+// repository is the full name of the repository. E.g. mercari/kubetempura
+func (c *Client) ListPullRequestFiles(ctx context.Context, repository string, number string) ([]string, error) {
+	var ret []string
+	for page := 1; ; page++ {
+		var files []struct {
+			Filename string `json:"filename"`
+		}
+		query := url.Values{}
+		query.Set("per_page", strconv.Itoa(perPage))
+		query.Set("page", strconv.Itoa(page))
+		if err := c.get(ctx, "repos/"+repository+"/pulls/"+number+"/files", query, &files); err != nil {
+			return nil, err
+		}
+		for _, f := range files {
+			ret = append(ret, f.Filename)
+		}
+		if len(files) < perPage {
+			return ret, nil
+		}
+	}
+}
+
+// ListOpenPullRequests returns the open pull requests of the repository.
+// A pull request of the API is the same as the one in a webhook, so each of them is returned in a payload of the webhook without the action.
+func (c *Client) ListOpenPullRequests(ctx context.Context, repository string) ([]github.PullRequestPayload, error) {
+	var ret []github.PullRequestPayload
+	for page := 1; ; page++ {
+		var pullRequests []json.RawMessage
+		query := url.Values{}
+		query.Set("state", "open")
+		query.Set("per_page", strconv.Itoa(perPage))
+		query.Set("page", strconv.Itoa(page))
+		if err := c.get(ctx, "repos/"+repository+"/pulls", query, &pullRequests); err != nil {
+			return nil, err
+		}
+		for _, raw := range pullRequests {
+			var payload github.PullRequestPayload
+			if err := json.Unmarshal(raw, &payload.PullRequest); err != nil {
+				return nil, err
+			}
+			payload.Number = payload.PullRequest.Number
+			ret = append(ret, payload)
+		}
+		if len(pullRequests) < perPage {
+			return ret, nil
+		}
+	}
+}
+
+// IsTeamMember returns true when the user is an active member of the team.
+func (c *Client) IsTeamMember(ctx context.Context, org string, teamSlug string, login string) (bool, error) {
+	var membership struct {
+		State string `json:"state"`
+	}
+	err := c.get(ctx, "orgs/"+org+"/teams/"+teamSlug+"/memberships/"+login, nil, &membership)
+	if apiErr, ok := err.(*APIError); ok && apiErr.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return membership.State == "active", nil
+}
+
+// GetPullRequest returns the pull request in a payload of the webhook without the action.
+func (c *Client) GetPullRequest(ctx context.Context, repository string, number string) (github.PullRequestPayload, error) {
+	var payload github.PullRequestPayload
+	if err := c.get(ctx, "repos/"+repository+"/pulls/"+number, nil, &payload.PullRequest); err != nil {
+		return payload, err
+	}
+	payload.Number = payload.PullRequest.Number
+	return payload, nil
+}
+
+// GetCollaboratorPermission returns the permission of the user for the repository. It's one of admin, write, read or none.
+func (c *Client) GetCollaboratorPermission(ctx context.Context, repository string, login string) (string, error) {
+	var permission struct {
+		Permission string `json:"permission"`
+	}
+	if err := c.get(ctx, "repos/"+repository+"/collaborators/"+login+"/permission", nil, &permission); err != nil {
+		return "", err
+	}
+	return permission.Permission, nil
+}
+
+// CreateCommentReaction adds a reaction to the comment of an issue or a pull request. E.g. +1
+func (c *Client) CreateCommentReaction(ctx context.Context, repository string, commentID int64, content string) error {
+	body, err := json.Marshal(map[string]string{"content": content})
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, http.MethodPost, "repos/"+repository+"/issues/comments/"+strconv.FormatInt(commentID, 10)+"/reactions", nil, body, nil)
+}
+
+// CommitStatus is a status of a commit. State is one of error, failure, pending or success.
+type CommitStatus struct {
+	State       string `json:"state"`
+	TargetURL   string `json:"target_url,omitempty"`
+	Description string `json:"description,omitempty"`
+	Context     string `json:"context,omitempty"`
+}
+
+// CreateCommitStatus creates a status of the commit. The latest status of each context is shown in the pull request.
+func (c *Client) CreateCommitStatus(ctx context.Context, repository string, sha string, status CommitStatus) error {
+	body, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, http.MethodPost, "repos/"+repository+"/statuses/"+sha, nil, body, nil)
+}
+
+// CheckRun is a check run or a workflow run of a commit. Conclusion is empty until it's completed.
+type CheckRun struct {
+	Name       string `json:"name"`
+	Status     string `json:"status"`
+	Conclusion string `json:"conclusion"`
+}
+
+// ListCheckRuns returns the latest check runs of the commit with the name. It returns up to 100 runs.
+func (c *Client) ListCheckRuns(ctx context.Context, repository string, sha string, name string) ([]CheckRun, error) {
+	var runs struct {
+		CheckRuns []CheckRun `json:"check_runs"`
+	}
+	query := url.Values{}
+	query.Set("check_name", name)
+	query.Set("per_page", strconv.Itoa(perPage))
+	if err := c.get(ctx, "repos/"+repository+"/commits/"+sha+"/check-runs", query, &runs); err != nil {
+		return nil, err
+	}
+	return runs.CheckRuns, nil
+}
+
+// ListWorkflowRuns returns the latest workflow runs of GitHub Actions for the commit. It returns up to 100 runs.
+func (c *Client) ListWorkflowRuns(ctx context.Context, repository string, sha string) ([]CheckRun, error) {
+	var runs struct {
+		WorkflowRuns []CheckRun `json:"workflow_runs"`
+	}
+	query := url.Values{}
+	query.Set("head_sha", sha)
+	query.Set("per_page", strconv.Itoa(perPage))
+	if err := c.get(ctx, "repos/"+repository+"/actions/runs", query, &runs); err != nil {
+		return nil, err
+	}
+	return runs.WorkflowRuns, nil
+}
+
+func (c *Client) get(ctx context.Context, path string, query url.Values, v interface{}) error {
+	return c.do(ctx, http.MethodGet, path, query, nil, v)
+}
+
+// do sends the request. The response is decoded into v unless it's nil.
+func (c *Client) do(ctx context.Context, method string, path string, query url.Values, body []byte, v interface{}) error {
+	u := strings.TrimSuffix(c.BaseURL, "/") + "/" + path
+	if len(query) != 0 {
+		u += "?" + query.Encode()
+	}
+	var reqBody io.Reader
+	if body != nil {
+		reqBody = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "token "+c.Token)
+	}
+	res, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return &APIError{StatusCode: res.StatusCode, URL: u}
+	}
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+// APIError is an error response of the GitHub REST API.
+type APIError struct {
+	StatusCode int
+	URL        string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("GitHub API returned %d for %s", e.StatusCode, e.URL)
+}
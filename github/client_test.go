@@ -0,0 +1,79 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestListPullRequestFiles(t *testing.T) {
+	var files []map[string]string
+	for i := 0; i < perPage+1; i++ {
+		files = append(files, map[string]string{"filename": fmt.Sprintf("services/web/%d.go", i)})
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/mercari/kubetempura/pulls/10/files" {
+			http.NotFound(w, r)
+			return
+		}
+		if got := r.Header.Get("Authorization"); got != "token foo" {
+			t.Errorf("Authorization = %v, want token foo", got)
+		}
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		start := (page - 1) * perPage
+		end := start + perPage
+		if end > len(files) {
+			end = len(files)
+		}
+		_ = json.NewEncoder(w).Encode(files[start:end])
+	}))
+	defer server.Close()
+
+	gh := NewClient(server.URL, "foo")
+	got, err := gh.ListPullRequestFiles(context.Background(), "mercari/kubetempura", "10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want []string
+	for _, f := range files {
+		want = append(want, f["filename"])
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("ListPullRequestFiles() = %v, want %v", got, want)
+	}
+
+	_, err = gh.ListPullRequestFiles(context.Background(), "mercari/not-exists", "10")
+	if apiErr, ok := err.(*APIError); !ok || apiErr.StatusCode != http.StatusNotFound {
+		t.Fatalf("ListPullRequestFiles() error = %v, want 404", err)
+	}
+}
+
+func TestCreateCommitStatus(t *testing.T) {
+	var got CommitStatus
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/repos/mercari/kubetempura/statuses/abcdefg" {
+			http.NotFound(w, r)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("failed to decode the status: %v", err)
+		}
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"id": 1}`))
+	}))
+	defer server.Close()
+
+	gh := NewClient(server.URL, "foo")
+	want := CommitStatus{State: "success", Context: "kubetempura/echo", Description: "The review app is deployed to default"}
+	if err := gh.CreateCommitStatus(context.Background(), "mercari/kubetempura", "abcdefg", want); err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Fatalf("status = %+v, want %+v", got, want)
+	}
+}
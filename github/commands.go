@@ -0,0 +1,240 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	kubetempurav1 "github.com/mercari/kubetempura/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// commandPrefix starts a command in a comment of a pull request. E.g. /tempura deploy
+	commandPrefix = "/tempura"
+
+	// commandDeploy creates the review app even if the pull request doesn't match the filters, and keeps it until the pull request is closed.
+	commandDeploy = "deploy"
+	// commandDestroy deletes the review app. The next event of the pull request creates it again if the pull request matches the filters.
+	commandDestroy = "destroy"
+	// commandRedeploy deletes the resources of the review app and creates them again.
+	commandRedeploy = "redeploy"
+	// commandEnv sets the environment variables of the review app with NAME=VALUE, and removes them with -NAME.
+	// They override the environment variables in the description of the pull request.
+	commandEnv = "env"
+)
+
+// command is a command in a comment of a pull request. E.g. /tempura env FOO=bar
+type command struct {
+	name string
+	args []string
+	// commenter is the login of the author of the comment.
+	commenter string
+	// commentID is the ID of the comment to react to.
+	commentID int64
+}
+
+// commander is implemented by a provider which accepts the commands in the comments of the pull requests.
+type commander interface {
+	// canRunCommand returns true when the commenter has the write permission of the repository.
+	canRunCommand(ctx context.Context, e *pullRequestEvent) (bool, error)
+	// getPullRequestEvent returns the current state of the pull request of the command, because the payload of a comment doesn't have it.
+	getPullRequestEvent(ctx context.Context, e *pullRequestEvent) (*pullRequestEvent, error)
+	// acknowledge tells the commenter whether the command was run. E.g. with a reaction to the comment
+	acknowledge(ctx context.Context, e *pullRequestEvent, accepted bool) error
+}
+
+// parseCommand returns the first valid command in the comment. A command must be at the start of a line.
+func parseCommand(body string) (*command, bool) {
+	for _, line := range strings.Split(body, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[0] != commandPrefix {
+			continue
+		}
+		cmd := &command{name: fields[1], args: fields[2:]}
+		switch cmd.name {
+		case commandDeploy, commandDestroy, commandRedeploy:
+			if len(cmd.args) == 0 {
+				return cmd, true
+			}
+		case commandEnv:
+			if _, _, err := parseEnvArgs(cmd.args); err == nil && len(cmd.args) != 0 {
+				return cmd, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// parseEnvArgs returns the environment variables to set by NAME=VALUE and the names to remove by -NAME.
+func parseEnvArgs(args []string) ([]corev1.EnvVar, []string, error) {
+	var set []corev1.EnvVar
+	var unset []string
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") {
+			name := arg[1:]
+			if errs := validation.IsEnvVarName(name); len(errs) != 0 {
+				return nil, nil, fmt.Errorf("invalid name %q: %s", name, strings.Join(errs, ", "))
+			}
+			unset = append(unset, name)
+			continue
+		}
+		i := strings.Index(arg, "=")
+		if i < 0 {
+			return nil, nil, fmt.Errorf("invalid argument %q. It must be NAME=VALUE or -NAME", arg)
+		}
+		if errs := validation.IsEnvVarName(arg[:i]); len(errs) != 0 {
+			return nil, nil, fmt.Errorf("invalid name %q: %s", arg[:i], strings.Join(errs, ", "))
+		}
+		set = append(set, corev1.EnvVar{Name: arg[:i], Value: arg[i+1:]})
+	}
+	return set, unset, nil
+}
+
+// applyEnvArgs returns the environment variables updated by the arguments of /tempura env.
+func applyEnvArgs(envVars []corev1.EnvVar, set []corev1.EnvVar, unset []string) []corev1.EnvVar {
+	removed := map[string]bool{}
+	for _, name := range unset {
+		removed[name] = true
+	}
+	for _, envVar := range set {
+		removed[envVar.Name] = true
+	}
+	var ret []corev1.EnvVar
+	for _, envVar := range envVars {
+		if !removed[envVar.Name] {
+			ret = append(ret, envVar)
+		}
+	}
+	return append(ret, set...)
+}
+
+// handleCommand runs the command for the ReviewApps of the repository if the commenter has the permission.
+// Only the ReviewApps in the namespace handle the command. An empty namespace means all namespaces.
+func handleCommand(ctx context.Context, p provider, e *pullRequestEvent, namespace string, c client.Client) error {
+	cmdr, ok := p.(commander)
+	if !ok {
+		return nil
+	}
+	allowed, err := cmdr.canRunCommand(ctx, e)
+	if err != nil {
+		return fmt.Errorf("failed to get the permission of %s: %w", e.command.commenter, err)
+	}
+	if !allowed {
+		log.Info("Ignored the command of a user without the write permission", "user", e.command.commenter, "command", e.command.name)
+		acknowledgeCommand(ctx, cmdr, e, false)
+		return nil
+	}
+	current, err := cmdr.getPullRequestEvent(ctx, e)
+	if err != nil {
+		return fmt.Errorf("failed to get the pull request: %w", err)
+	}
+	if current.closed {
+		log.Info("Ignored the command for a closed pull request", "repository", e.pullRequest.repository, "number", e.pullRequest.number)
+		return nil
+	}
+	current.sharedEndpoint = e.sharedEndpoint
+	current.pullRequest.current = current.current
+	reviewApps, err := findReviewAppsOfEvent(ctx, c, p, current, namespace)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, reviewApp := range reviewApps {
+		pullRequest, ok, err := deployablePullRequest(ctx, p, current, reviewApp, c)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to run %s %s for %s: %w", commandPrefix, e.command.name, reviewApp.Name, err))
+			continue
+		}
+		if !ok {
+			log.Info("Ignored the command until the required check succeeds", "reviewApp", reviewApp.Name, "prNumber", current.pullRequest.number, "check", reviewApp.Spec.RequiredCheck)
+			continue
+		}
+		err = runCommand(ctx, e.command, reviewApp, pullRequest, c)
+		if err == errStaleEvent {
+			log.Info("Ignored an older event", "reviewApp", reviewApp.Name, "prNumber", current.pullRequest.number)
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to run %s %s for %s: %w", commandPrefix, e.command.name, reviewApp.Name, err))
+		}
+	}
+	if err := utilerrors.NewAggregate(errs); err != nil {
+		return err
+	}
+	acknowledgeCommand(ctx, cmdr, e, true)
+	return nil
+}
+
+// acknowledgeCommand logs a failure of the acknowledgement, because the command is already handled.
+func acknowledgeCommand(ctx context.Context, cmdr commander, e *pullRequestEvent, accepted bool) {
+	if err := cmdr.acknowledge(ctx, e, accepted); err != nil {
+		log.Error(err, "Failed to acknowledge the command", "commentID", e.command.commentID)
+	}
+}
+
+// runCommand changes the PR of the ReviewApp for the pull request.
+func runCommand(ctx context.Context, cmd *command, reviewApp kubetempurav1.ReviewApp, pullRequest pullRequest, c client.Client) error {
+	switch cmd.name {
+	case commandDeploy:
+		return updatePRWithRetry(ctx, reviewApp, pullRequest, c, func(spec *kubetempurav1.PRSpec) {
+			spec.Pinned = true
+		})
+	case commandDestroy:
+		prs, err := findPRs(ctx, reviewApp, pullRequest.repositoryID(), pullRequest.number, c)
+		if err != nil {
+			return err
+		}
+		for i := range prs {
+			if err := c.Delete(ctx, &prs[i]); client.IgnoreNotFound(err) != nil {
+				return err
+			}
+		}
+		return nil
+	case commandRedeploy:
+		return updateExistingPR(ctx, reviewApp, pullRequest, c, func(spec *kubetempurav1.PRSpec) {
+			now := metav1.Now()
+			spec.RedeployRequestedAt = &now
+		})
+	case commandEnv:
+		set, unset, err := parseEnvArgs(cmd.args)
+		if err != nil {
+			return err
+		}
+		return updateExistingPR(ctx, reviewApp, pullRequest, c, func(spec *kubetempurav1.PRSpec) {
+			spec.CommandEnvVars = applyEnvArgs(spec.CommandEnvVars, set, unset)
+		})
+	}
+	return nil
+}
+
+// updateExistingPR updates the PR of the ReviewApp for the pull request. It does nothing when the review app isn't deployed.
+func updateExistingPR(ctx context.Context, reviewApp kubetempurav1.ReviewApp, pullRequest pullRequest, c client.Client, edit func(spec *kubetempurav1.PRSpec)) error {
+	prs, err := findPRs(ctx, reviewApp, pullRequest.repositoryID(), pullRequest.number, c)
+	if err != nil {
+		return err
+	}
+	if len(prs) == 0 {
+		log.Info("Ignored the command because the review app isn't deployed", "reviewApp", reviewApp.Name, "prNumber", pullRequest.number)
+		return nil
+	}
+	return updatePRWithRetry(ctx, reviewApp, pullRequest, c, edit)
+}
+
+// isPinned returns true when the PR of the ReviewApp for the pull request was deployed by /tempura deploy.
+func isPinned(ctx context.Context, reviewApp kubetempurav1.ReviewApp, pullRequest pullRequest, c client.Client) (bool, error) {
+	prs, err := findPRs(ctx, reviewApp, pullRequest.repositoryID(), pullRequest.number, c)
+	if err != nil {
+		return false, err
+	}
+	for _, pr := range prs {
+		if pr.Spec.Pinned {
+			return true, nil
+		}
+	}
+	return false, nil
+}
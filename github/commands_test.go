@@ -0,0 +1,265 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-playground/webhooks/v6/github"
+	kubetempurav1 "github.com/mercari/kubetempura/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParseCommand(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		wantName string
+		wantArgs []string
+		wantOK   bool
+	}{
+		{name: "deploy", body: "/tempura deploy", wantName: commandDeploy, wantOK: true},
+		{name: "in a line", body: "LGTM\r\n/tempura  redeploy  \nthanks", wantName: commandRedeploy, wantOK: true},
+		{name: "env", body: "/tempura env FOO=bar -BAZ", wantName: commandEnv, wantArgs: []string{"FOO=bar", "-BAZ"}, wantOK: true},
+		{name: "env with an equal sign in the value", body: "/tempura env QUERY=a=b", wantName: commandEnv, wantArgs: []string{"QUERY=a=b"}, wantOK: true},
+		{name: "env without arguments", body: "/tempura env"},
+		{name: "env with an invalid name", body: "/tempura env FOO"},
+		{name: "deploy with arguments", body: "/tempura deploy now"},
+		{name: "unknown", body: "/tempura rollback"},
+		{name: "not at the start of a line", body: "Run /tempura deploy"},
+		{name: "no command", body: "LGTM"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseCommand(tt.body)
+			if ok != tt.wantOK {
+				t.Fatalf("parseCommand() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if got.name != tt.wantName || len(got.args) != len(tt.wantArgs) || (len(got.args) != 0 && !reflect.DeepEqual(got.args, tt.wantArgs)) {
+				t.Fatalf("parseCommand() = %+v, want %v %v", got, tt.wantName, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestApplyEnvArgs(t *testing.T) {
+	envVars := []corev1.EnvVar{{Name: "FOO", Value: "1"}, {Name: "BAR", Value: "2"}, {Name: "BAZ", Value: "3"}}
+	set, unset, err := parseEnvArgs([]string{"FOO=4", "-BAR", "QUX="})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := applyEnvArgs(envVars, set, unset)
+	want := []corev1.EnvVar{{Name: "BAZ", Value: "3"}, {Name: "FOO", Value: "4"}, {Name: "QUX", Value: ""}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("applyEnvArgs() = %v, want %v", got, want)
+	}
+}
+
+func TestNewCommentEvent(t *testing.T) {
+	var icp github.IssueCommentPayload
+	payload := `{
+		"action": "created",
+		"issue": {"number": 1, "pull_request": {"url": "https://api.github.com/repos/mercari/kubetempura/pulls/1"}},
+		"comment": {"id": 10, "body": "/tempura deploy", "user": {"login": "octocat"}},
+		"repository": {"html_url": "https://github.com/mercari/kubetempura", "full_name": "mercari/kubetempura"}
+	}`
+	if err := json.Unmarshal([]byte(payload), &icp); err != nil {
+		t.Fatal(err)
+	}
+	got, err := newCommentEvent(icp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.pullRequest.number != "1" || got.pullRequest.repository != "mercari/kubetempura" || got.command.commenter != "octocat" || got.command.commentID != 10 {
+		t.Fatalf("newCommentEvent() = %+v, %+v", got, got.command)
+	}
+
+	icp.Issue.PullRequest = nil
+	if _, err := newCommentEvent(icp); err != errIgnoredEvent {
+		t.Fatalf("newCommentEvent() error = %v, a comment of an issue must be ignored", err)
+	}
+}
+
+// fakeGitHubAPI serves a pull request without the required label, and the permissions of the users.
+func fakeGitHubAPI(t *testing.T) (*httptest.Server, func() []string) {
+	var mu sync.Mutex
+	var reactions []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/repos/mercari/kubetempura/pulls/1":
+			_, _ = w.Write([]byte(`{"number": 1, "state": "open", "head": {"sha": "abcdefg", "ref": "feature"}, "base": {"ref": "main"}, "updated_at": "2021-07-02T00:00:00Z"}`))
+		case strings.HasPrefix(r.URL.Path, "/repos/mercari/kubetempura/collaborators/"):
+			permission := "read"
+			if strings.Contains(r.URL.Path, "/octocat/") {
+				permission = "write"
+			}
+			_, _ = w.Write([]byte(`{"permission": "` + permission + `"}`))
+		case r.URL.Path == "/repos/mercari/kubetempura/issues/comments/10/reactions":
+			var reaction struct {
+				Content string `json:"content"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&reaction)
+			mu.Lock()
+			reactions = append(reactions, reaction.Content)
+			mu.Unlock()
+			w.WriteHeader(http.StatusCreated)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	return server, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), reactions...)
+	}
+}
+
+func TestHandleCommand(t *testing.T) {
+	server, reactions := fakeGitHubAPI(t)
+	defer server.Close()
+
+	web := &kubetempurav1.ReviewApp{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+		Spec:       kubetempurav1.ReviewAppSpec{GithubRepository: "https://github.com/mercari/kubetempura", RequiredLabel: "deploy"},
+	}
+	c := newFakeClient(t, web)
+	p, err := newGitHubProvider(NewClient(server.URL, ""), WebhookOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	run := func(commenter string, body string) {
+		t.Helper()
+		cmd, ok := parseCommand(body)
+		if !ok {
+			t.Fatalf("parseCommand(%q) must return the command", body)
+		}
+		cmd.commenter = commenter
+		cmd.commentID = 10
+		e := &pullRequestEvent{
+			repository:  "https://github.com/mercari/kubetempura",
+			pullRequest: pullRequest{number: "1", repository: "mercari/kubetempura"},
+			command:     cmd,
+		}
+		if err := handleCommand(context.Background(), p, e, "", c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	getPR := func() *kubetempurav1.PR {
+		t.Helper()
+		prs, err := findPRs(context.Background(), *web, "mercari/kubetempura", "1", c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(prs) == 0 {
+			return nil
+		}
+		return &prs[0]
+	}
+
+	run("guest", "/tempura deploy")
+	if pr := getPR(); pr != nil {
+		t.Fatalf("PR = %v, a user without the write permission must not deploy it", pr)
+	}
+	run("octocat", "/tempura env FOO=bar")
+	if pr := getPR(); pr != nil {
+		t.Fatalf("PR = %v, /tempura env must not deploy it", pr)
+	}
+
+	run("octocat", "/tempura deploy")
+	pr := getPR()
+	if pr == nil || !pr.Spec.Pinned || pr.Spec.HeadCommitRef != "abcdefg" {
+		t.Fatalf("PR = %v, want the pinned PR", pr)
+	}
+
+	run("octocat", "/tempura env FOO=bar")
+	// The PR is kept with the environment variables even though the pull request doesn't have the required label.
+	// The resync reads the new commit in the same second as the command.
+	e := &pullRequestEvent{
+		repository:  "https://github.com/mercari/kubetempura",
+		pullRequest: pullRequest{number: "1", headSHA: "hijklmn", updatedAt: time.Date(2021, 7, 2, 0, 0, 0, 0, time.UTC), repository: "mercari/kubetempura"},
+		current:     true,
+	}
+	if err := handlePullRequest(context.Background(), p, e, "", c); err != nil {
+		t.Fatal(err)
+	}
+	pr = getPR()
+	if pr == nil || pr.Spec.HeadCommitRef != "hijklmn" || !reflect.DeepEqual(pr.Spec.CommandEnvVars, []corev1.EnvVar{{Name: "FOO", Value: "bar"}}) {
+		t.Fatalf("PR = %v, want the PR updated with the environment variables", pr)
+	}
+
+	run("octocat", "/tempura redeploy")
+	if pr := getPR(); pr == nil || pr.Spec.RedeployRequestedAt == nil {
+		t.Fatalf("PR = %v, want the redeploy requested", pr)
+	}
+
+	run("octocat", "/tempura destroy")
+	if pr := getPR(); pr != nil {
+		t.Fatalf("PR = %v, want it deleted", pr)
+	}
+
+	want := []string{"-1", "+1", "+1", "+1", "+1", "+1"}
+	if got := reactions(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("reactions = %v, want %v", got, want)
+	}
+}
+
+func TestHandlePullRequestPinnedFork(t *testing.T) {
+	server, _ := fakeGitHubAPI(t)
+	defer server.Close()
+
+	web := &kubetempurav1.ReviewApp{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+		Spec: kubetempurav1.ReviewAppSpec{
+			GithubRepository: "https://github.com/mercari/kubetempura",
+			ForkPolicy:       kubetempurav1.ForkPolicy{Mode: kubetempurav1.ForkPolicyIgnore},
+			Authors:          kubetempurav1.AuthorFilter{Deny: kubetempurav1.UserFilter{Users: []string{"mallory"}}},
+		},
+	}
+	c := newFakeClient(t, web)
+	p, err := newGitHubProvider(NewClient(server.URL, ""), WebhookOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd, _ := parseCommand("/tempura deploy")
+	cmd.commenter = "octocat"
+	cmd.commentID = 10
+	e := &pullRequestEvent{
+		repository:  "https://github.com/mercari/kubetempura",
+		pullRequest: pullRequest{number: "1", repository: "mercari/kubetempura"},
+		command:     cmd,
+	}
+	if err := handleCommand(context.Background(), p, e, "", c); err != nil {
+		t.Fatal(err)
+	}
+
+	// The commits pushed and the descriptions edited later by a fork or a denied author aren't deployed, and the pinned PR is kept.
+	updatedAt := time.Date(2021, 7, 3, 0, 0, 0, 0, time.UTC)
+	description := "```kubetempura\nenv:\n  FOO: bar\nvars:\n  IMAGE_TAG: evil\n```"
+	for _, pr := range []pullRequest{
+		{number: "1", headSHA: "fork", fork: true, updatedAt: updatedAt, repository: "mercari/kubetempura"},
+		{number: "1", headSHA: "abcdefg", fork: true, description: description, updatedAt: updatedAt.Add(time.Minute), repository: "mercari/kubetempura"},
+		{number: "1", headSHA: "denied", author: "mallory", updatedAt: updatedAt.Add(2 * time.Minute), repository: "mercari/kubetempura"},
+	} {
+		e := &pullRequestEvent{repository: "https://github.com/mercari/kubetempura", pullRequest: pr}
+		if err := handlePullRequest(context.Background(), p, e, "", c); err != nil {
+			t.Fatal(err)
+		}
+		prs, err := findPRs(context.Background(), *web, "mercari/kubetempura", "1", c)
+		if err != nil || len(prs) != 1 || !prs[0].Spec.Pinned || prs[0].Spec.HeadCommitRef != "abcdefg" {
+			t.Fatalf("findPRs() = %v, %v, want the PR of the commit deployed by the command", prs, err)
+		}
+		if prs[0].Spec.EnvVars != nil || prs[0].Spec.Vars != nil {
+			t.Fatalf("spec = %+v, the description edited by a fork must not be deployed", prs[0].Spec)
+		}
+	}
+}
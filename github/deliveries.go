@@ -0,0 +1,64 @@
+package github
+
+import (
+	"container/list"
+	"sync"
+)
+
+// deliveryCacheSize is the number of the deliveries to remember. GitHub redelivers a webhook only when it's asked to.
+const deliveryCacheSize = 1000
+
+// deliveryCache remembers the IDs of the processed deliveries to ignore the redeliveries.
+// The least recently added one is forgotten when the cache is full.
+type deliveryCache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+func newDeliveryCache(size int) *deliveryCache {
+	return &deliveryCache{
+		size:    size,
+		order:   list.New(),
+		entries: map[string]*list.Element{},
+	}
+}
+
+// seen returns true when the delivery was already processed.
+func (c *deliveryCache) seen(id string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.entries[id]
+	return ok
+}
+
+// checkAndAdd records the delivery as processed, and returns false when it was already recorded.
+// Only one of the concurrent requests of the same delivery gets true. An empty ID is always accepted and never recorded.
+func (c *deliveryCache) checkAndAdd(id string) bool {
+	if id == "" {
+		return true
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[id]; ok {
+		return false
+	}
+	c.entries[id] = c.order.PushBack(id)
+	for c.order.Len() > c.size {
+		oldest := c.order.Front()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(string))
+	}
+	return true
+}
+
+// remove forgets the delivery.
+func (c *deliveryCache) remove(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[id]; ok {
+		c.order.Remove(e)
+		delete(c.entries, id)
+	}
+}
@@ -0,0 +1,57 @@
+package github
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestDeliveryCache(t *testing.T) {
+	c := newDeliveryCache(2)
+	if !c.checkAndAdd("a") || !c.checkAndAdd("b") || !c.checkAndAdd("") {
+		t.Fatalf("checkAndAdd() must be true for the new deliveries")
+	}
+	if c.checkAndAdd("a") || !c.checkAndAdd("") {
+		t.Fatalf("checkAndAdd() must be false only for the recorded delivery")
+	}
+	if !c.seen("a") || !c.seen("b") || c.seen("") {
+		t.Fatalf("seen() must be true only for a and b")
+	}
+	c.checkAndAdd("c")
+	if c.seen("a") {
+		t.Fatalf("the oldest delivery must be forgotten")
+	}
+	if !c.seen("b") || !c.seen("c") {
+		t.Fatalf("the newer deliveries must be kept")
+	}
+	c.remove("b")
+	if !c.checkAndAdd("b") {
+		t.Fatalf("checkAndAdd() must be true for the removed delivery")
+	}
+}
+
+func TestDeliveryCacheConcurrently(t *testing.T) {
+	c := newDeliveryCache(deliveryCacheSize)
+	for i := 0; i < 20; i++ {
+		id := fmt.Sprint(i)
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		accepted := 0
+		// The redeliveries of the same delivery arrive at the same time.
+		for j := 0; j < 10; j++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if c.checkAndAdd(id) {
+					mu.Lock()
+					accepted++
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+		if accepted != 1 {
+			t.Fatalf("checkAndAdd() accepted %d requests of the delivery %s, want 1", accepted, id)
+		}
+	}
+}
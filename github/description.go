@@ -0,0 +1,79 @@
+package github
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/yaml"
+)
+
+// descriptionFence starts the block of the settings in the description of a pull request. It's closed by ```.
+const descriptionFence = "```kubetempura"
+
+// descriptionSettings is the block of the settings in the description of a pull request. E.g.
+//
+//	```kubetempura
+//	env:
+//	  LOG_LEVEL: debug
+//	vars:
+//	  IMAGE_TAG: v1.2.3
+//	```
+type descriptionSettings struct {
+	// Env has the environment variables of the containers.
+	Env map[string]string `json:"env,omitempty"`
+	// Vars has the variables of the templates.
+	Vars map[string]string `json:"vars,omitempty"`
+}
+
+// parseDescription returns the environment variables and the variables of the templates in the first block of the settings.
+// The description without the block returns nothing.
+func parseDescription(description string) ([]corev1.EnvVar, map[string]string, error) {
+	block, ok := findDescriptionBlock(description)
+	if !ok {
+		return nil, nil, nil
+	}
+	var settings descriptionSettings
+	if err := yaml.UnmarshalStrict([]byte(block), &settings); err != nil {
+		return nil, nil, fmt.Errorf("invalid block %s: %w", descriptionFence, err)
+	}
+	var envVars []corev1.EnvVar
+	for name, value := range settings.Env {
+		if errs := validation.IsEnvVarName(name); len(errs) != 0 {
+			return nil, nil, fmt.Errorf("invalid name %q of env: %s", name, strings.Join(errs, ", "))
+		}
+		envVars = append(envVars, corev1.EnvVar{Name: name, Value: value})
+	}
+	// Sort the environment variables so that the same description renders the same PR.
+	sort.Slice(envVars, func(i, j int) bool { return envVars[i].Name < envVars[j].Name })
+	for name := range settings.Vars {
+		// A name is a part of the regular expression of the placeholder, so it must be an identifier.
+		if errs := validation.IsCIdentifier(name); len(errs) != 0 {
+			return nil, nil, fmt.Errorf("invalid name %q of vars: %s", name, strings.Join(errs, ", "))
+		}
+	}
+	if len(settings.Vars) == 0 {
+		settings.Vars = nil
+	}
+	return envVars, settings.Vars, nil
+}
+
+// findDescriptionBlock returns the content of the first block of the settings. An unclosed block ends at the end of the description.
+func findDescriptionBlock(description string) (string, bool) {
+	var lines []string
+	inBlock := false
+	for _, line := range strings.Split(description, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if !inBlock {
+			inBlock = trimmed == descriptionFence
+			continue
+		}
+		if strings.HasPrefix(trimmed, "```") {
+			break
+		}
+		lines = append(lines, strings.TrimRight(line, "\r"))
+	}
+	return strings.Join(lines, "\n"), inBlock
+}
@@ -0,0 +1,64 @@
+package github
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestParseDescription(t *testing.T) {
+	tests := []struct {
+		name        string
+		description string
+		wantEnvVars []corev1.EnvVar
+		wantVars    map[string]string
+		wantErr     bool
+	}{
+		{
+			name:        "no block",
+			description: "Fix a bug\n\n```yaml\nenv:\n  FOO: bar\n```",
+		},
+		{
+			name:        "env and vars",
+			description: "Fix a bug\r\n\r\n```kubetempura\r\nenv:\r\n  LOG_LEVEL: debug\r\n  FEATURE_X: \"true\"\r\nvars:\r\n  IMAGE_TAG: v1.2.3\r\n```\r\nThanks",
+			wantEnvVars: []corev1.EnvVar{{Name: "FEATURE_X", Value: "true"}, {Name: "LOG_LEVEL", Value: "debug"}},
+			wantVars:    map[string]string{"IMAGE_TAG": "v1.2.3"},
+		},
+		{
+			name:        "first block",
+			description: "```kubetempura\nvars:\n  IMAGE_TAG: v1\n```\n```kubetempura\nvars:\n  IMAGE_TAG: v2\n```",
+			wantVars:    map[string]string{"IMAGE_TAG": "v1"},
+		},
+		{
+			name:        "empty block",
+			description: "```kubetempura\n```",
+		},
+		{
+			name:        "unknown field",
+			description: "```kubetempura\nenvs:\n  FOO: bar\n```",
+			wantErr:     true,
+		},
+		{
+			name:        "invalid name of env",
+			description: "```kubetempura\nenv:\n  1FOO: bar\n```",
+			wantErr:     true,
+		},
+		{
+			name:        "invalid name of vars",
+			description: "```kubetempura\nvars:\n  IMAGE.TAG: v1\n```",
+			wantErr:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			envVars, vars, err := parseDescription(tt.description)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseDescription() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(envVars, tt.wantEnvVars) || !reflect.DeepEqual(vars, tt.wantVars) {
+				t.Fatalf("parseDescription() = %v, %v, want %v, %v", envVars, vars, tt.wantEnvVars, tt.wantVars)
+			}
+		})
+	}
+}
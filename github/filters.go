@@ -0,0 +1,166 @@
+package github
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-playground/webhooks/v6/github"
+	kubetempurav1 "github.com/mercari/kubetempura/api/v1"
+)
+
+// pullRequest is the state of a pull request which decides whether a ReviewApp deploys it.
+type pullRequest struct {
+	number     string
+	headSHA    string
+	labels     []string
+	baseBranch string
+	headBranch string
+	draft      bool
+	// fork is true when the head repository differs from the base repository.
+	fork   bool
+	author string
+	// updatedAt orders the events of the pull request.
+	updatedAt time.Time
+	// repository is the full name of the repository. E.g. mercari/kubetempura
+	repository string
+	// host is the host of the repository. E.g. github.com
+	host string
+	// description may have the settings of the review apps. See parseDescription.
+	description string
+	// changedFiles is only fetched when a ReviewApp has the path filters.
+	changedFiles []string
+	// addedLabels are the labels added by the event. The approval label of the fork policy approves the head commit.
+	addedLabels []string
+	// current is true when the pull request was read from the API. See isStale.
+	current bool
+}
+
+func newPullRequest(prp github.PullRequestPayload) pullRequest {
+	pr := pullRequest{
+		number:     strconv.FormatInt(prp.Number, 10),
+		headSHA:    prp.PullRequest.Head.Sha,
+		baseBranch: prp.PullRequest.Base.Ref,
+		headBranch: prp.PullRequest.Head.Ref,
+		draft:      prp.PullRequest.Draft,
+		// The head repository is null when the fork is deleted.
+		fork:        prp.PullRequest.Head.Repo.ID != prp.PullRequest.Base.Repo.ID,
+		author:      prp.PullRequest.User.Login,
+		updatedAt:   prp.PullRequest.UpdatedAt,
+		repository:  prp.Repository.FullName,
+		host:        repositoryHost(prp.Repository.HTMLURL),
+		description: prp.PullRequest.Body,
+	}
+	for _, label := range prp.PullRequest.Labels {
+		pr.labels = append(pr.labels, label.Name)
+	}
+	if prp.Action == "labeled" {
+		pr.addedLabels = []string{prp.Label.Name}
+	}
+	return pr
+}
+
+// repositoryID returns the repository with the host, which identifies the pull request with the number. E.g. github.com/mercari/kubetempura
+func (pr pullRequest) repositoryID() string {
+	return repositoryID(pr.host, pr.repository)
+}
+
+func (pr pullRequest) hasLabel(name string) bool {
+	for _, label := range pr.labels {
+		if label == name {
+			return true
+		}
+	}
+	return false
+}
+
+// shouldDeploy returns true when the ReviewApp wants a review app for the pull request.
+func shouldDeploy(reviewApp kubetempurav1.ReviewApp, pr pullRequest) bool {
+	if pr.draft && reviewApp.Spec.DraftPolicy == kubetempurav1.DraftPolicySkip {
+		return false
+	}
+	if reviewApp.Spec.RequiredLabel != "" && !pr.hasLabel(reviewApp.Spec.RequiredLabel) {
+		return false
+	}
+	if reviewApp.Spec.ExcludedLabel != "" && pr.hasLabel(reviewApp.Spec.ExcludedLabel) {
+		return false
+	}
+	if !matchFilter(reviewApp.Spec.BaseBranches, pr.baseBranch) {
+		return false
+	}
+	if !matchFilter(reviewApp.Spec.HeadBranches, pr.headBranch) {
+		return false
+	}
+	if hasPathFilter(reviewApp) && !matchAnyFile(reviewApp.Spec.Paths, pr.changedFiles) {
+		return false
+	}
+	return true
+}
+
+// shouldScaleDown returns true when the ReviewApp wants zero replicas for the pull request.
+func shouldScaleDown(reviewApp kubetempurav1.ReviewApp, pr pullRequest) bool {
+	return pr.draft && reviewApp.Spec.DraftPolicy == kubetempurav1.DraftPolicyScaleDown
+}
+
+func hasPathFilter(reviewApp kubetempurav1.ReviewApp) bool {
+	return len(reviewApp.Spec.Paths.Include) != 0 || len(reviewApp.Spec.Paths.Exclude) != 0
+}
+
+// matchAnyFile returns true when one of the files matches the filter.
+func matchAnyFile(filter kubetempurav1.PatternFilter, files []string) bool {
+	for _, file := range files {
+		if matchFilter(filter, file) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchFilter returns true when the value matches one of the included patterns (if any) and none of the excluded ones.
+func matchFilter(filter kubetempurav1.PatternFilter, value string) bool {
+	if len(filter.Include) != 0 && !matchAny(filter.Include, value) {
+		return false
+	}
+	return !matchAny(filter.Exclude, value)
+}
+
+func matchAny(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if matchPattern(pattern, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPattern matches the value with a glob pattern.
+// "*" matches any characters except "/", "**" matches any characters, and "?" matches a character except "/".
+func matchPattern(pattern string, value string) bool {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			// Also matches no directories. E.g. "**/*.go" matches "main.go".
+			b.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case pattern[i] == '*':
+			b.WriteString("[^/]*")
+		case pattern[i] == '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+	b.WriteString("$")
+	r, err := regexp.Compile(b.String())
+	if err != nil {
+		log.Error(err, "Invalid pattern", "pattern", pattern)
+		return false
+	}
+	return r.MatchString(value)
+}
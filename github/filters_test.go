@@ -0,0 +1,136 @@
+package github
+
+import (
+	"testing"
+
+	kubetempurav1 "github.com/mercari/kubetempura/api/v1"
+)
+
+func TestShouldDeploy(t *testing.T) {
+	tests := []struct {
+		name string
+		spec kubetempurav1.ReviewAppSpec
+		pr   pullRequest
+		want bool
+	}{
+		{
+			name: "no filters",
+			pr:   pullRequest{number: "1"},
+			want: true,
+		},
+		{
+			name: "with the required label",
+			spec: kubetempurav1.ReviewAppSpec{RequiredLabel: "review-app"},
+			pr:   pullRequest{number: "1", labels: []string{"bug", "review-app"}},
+			want: true,
+		},
+		{
+			name: "without the required label",
+			spec: kubetempurav1.ReviewAppSpec{RequiredLabel: "review-app"},
+			pr:   pullRequest{number: "1", labels: []string{"bug"}},
+			want: false,
+		},
+		{
+			name: "with the excluded label",
+			spec: kubetempurav1.ReviewAppSpec{RequiredLabel: "review-app", ExcludedLabel: "no-review-app"},
+			pr:   pullRequest{number: "1", labels: []string{"review-app", "no-review-app"}},
+			want: false,
+		},
+		{
+			name: "included base branch",
+			spec: kubetempurav1.ReviewAppSpec{BaseBranches: kubetempurav1.PatternFilter{Include: []string{"main", "develop"}}},
+			pr:   pullRequest{number: "1", baseBranch: "main", headBranch: "feature/foo"},
+			want: true,
+		},
+		{
+			name: "not included base branch",
+			spec: kubetempurav1.ReviewAppSpec{BaseBranches: kubetempurav1.PatternFilter{Include: []string{"main", "develop"}}},
+			pr:   pullRequest{number: "1", baseBranch: "release/1.0", headBranch: "feature/foo"},
+			want: false,
+		},
+		{
+			name: "excluded head branch",
+			spec: kubetempurav1.ReviewAppSpec{HeadBranches: kubetempurav1.PatternFilter{Exclude: []string{"dependabot/**"}}},
+			pr:   pullRequest{number: "1", baseBranch: "main", headBranch: "dependabot/go_modules/foo"},
+			want: false,
+		},
+		{
+			name: "changed included paths",
+			spec: kubetempurav1.ReviewAppSpec{Paths: kubetempurav1.PatternFilter{Include: []string{"services/web/**"}}},
+			pr:   pullRequest{number: "1", changedFiles: []string{"services/api/main.go", "services/web/main.go"}},
+			want: true,
+		},
+		{
+			name: "changed other paths",
+			spec: kubetempurav1.ReviewAppSpec{Paths: kubetempurav1.PatternFilter{Include: []string{"services/web/**"}}},
+			pr:   pullRequest{number: "1", changedFiles: []string{"services/api/main.go"}},
+			want: false,
+		},
+		{
+			name: "changed excluded paths only",
+			spec: kubetempurav1.ReviewAppSpec{Paths: kubetempurav1.PatternFilter{Exclude: []string{"**/*.md"}}},
+			pr:   pullRequest{number: "1", changedFiles: []string{"README.md", "docs/index.md"}},
+			want: false,
+		},
+		{
+			name: "draft with the default policy",
+			pr:   pullRequest{number: "1", draft: true},
+			want: true,
+		},
+		{
+			name: "draft with Skip",
+			spec: kubetempurav1.ReviewAppSpec{DraftPolicy: kubetempurav1.DraftPolicySkip},
+			pr:   pullRequest{number: "1", draft: true},
+			want: false,
+		},
+		{
+			name: "ready for review with Skip",
+			spec: kubetempurav1.ReviewAppSpec{DraftPolicy: kubetempurav1.DraftPolicySkip},
+			pr:   pullRequest{number: "1"},
+			want: true,
+		},
+		{
+			name: "draft with ScaleDown",
+			spec: kubetempurav1.ReviewAppSpec{DraftPolicy: kubetempurav1.DraftPolicyScaleDown},
+			pr:   pullRequest{number: "1", draft: true},
+			want: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reviewApp := kubetempurav1.ReviewApp{Spec: tt.spec}
+			if got := shouldDeploy(reviewApp, tt.pr); got != tt.want {
+				t.Fatalf("shouldDeploy() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		value   string
+		want    bool
+	}{
+		{pattern: "main", value: "main", want: true},
+		{pattern: "main", value: "main2", want: false},
+		{pattern: "release/*", value: "release/1.0", want: true},
+		{pattern: "release/*", value: "release/1.0/hotfix", want: false},
+		{pattern: "release/**", value: "release/1.0/hotfix", want: true},
+		{pattern: "v1.?", value: "v1.2", want: true},
+		{pattern: "v1.?", value: "v102", want: false},
+		{pattern: "**/*.go", value: "main.go", want: true},
+		{pattern: "**/*.go", value: "github/webhooks.go", want: true},
+		{pattern: "services/web/**", value: "services/web/main.go", want: true},
+		{pattern: "services/web/**", value: "services/api/main.go", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.value, func(t *testing.T) {
+			if got := matchPattern(tt.pattern, tt.value); got != tt.want {
+				t.Fatalf("matchPattern() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
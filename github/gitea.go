@@ -0,0 +1,147 @@
+package github
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	kubetempurav1 "github.com/mercari/kubetempura/api/v1"
+)
+
+// giteaPath is the path of the shared endpoint for Gitea.
+const giteaPath = "/gitea/webhooks"
+
+var errMissingGiteaSignature = errors.New("missing X-Gitea-Signature Header")
+
+// giteaProvider handles the webhooks of Gitea. go-playground/webhooks doesn't support Gitea, so the payloads are parsed here.
+// The changed files are not in the payload, so the paths filters never match.
+type giteaProvider struct{}
+
+func newGiteaProvider(_ *Client, _ WebhookOptions) (provider, error) {
+	return &giteaProvider{}, nil
+}
+
+func (p *giteaProvider) name() string {
+	return providerGitea
+}
+
+func (p *giteaProvider) path() string {
+	return giteaPath
+}
+
+// verify compares X-Gitea-Signature, which is the HMAC-SHA256 of the payload in hex without a prefix.
+func (p *giteaProvider) verify(header http.Header, payload []byte, secrets [][]byte) error {
+	if len(secrets) == 0 {
+		return nil
+	}
+	signature := header.Get("X-Gitea-Signature")
+	if signature == "" {
+		return errMissingGiteaSignature
+	}
+	return verifyHMAC(sha256.New, signature, payload, secrets)
+}
+
+// giteaPullRequestPayload is the part of the payload of a pull_request event used by KubeTempura.
+type giteaPullRequestPayload struct {
+	Action      string `json:"action"`
+	Number      int64  `json:"number"`
+	PullRequest struct {
+		User struct {
+			Login string `json:"login"`
+		} `json:"user"`
+		Body   string `json:"body"`
+		State  string `json:"state"`
+		Merged bool   `json:"merged"`
+		Labels []struct {
+			Name string `json:"name"`
+		} `json:"labels"`
+		Head      giteaBranch `json:"head"`
+		Base      giteaBranch `json:"base"`
+		UpdatedAt time.Time   `json:"updated_at"`
+	} `json:"pull_request"`
+	Repository struct {
+		HTMLURL  string `json:"html_url"`
+		FullName string `json:"full_name"`
+	} `json:"repository"`
+}
+
+type giteaBranch struct {
+	Ref    string `json:"ref"`
+	SHA    string `json:"sha"`
+	RepoID int64  `json:"repo_id"`
+}
+
+// parse handles the pull_request events. Gitea sends the changes of the labels and the pushes as pull_request events with their own actions.
+func (p *giteaProvider) parse(r *http.Request) (*pullRequestEvent, error) {
+	if r.Header.Get("X-Gitea-Event") != "pull_request" {
+		return nil, errIgnoredEvent
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	var prp giteaPullRequestPayload
+	if err := json.Unmarshal(body, &prp); err != nil {
+		return nil, err
+	}
+	return newGiteaEvent(prp)
+}
+
+func (p *giteaProvider) deliveryID(header http.Header) string {
+	return header.Get("X-Gitea-Delivery")
+}
+
+func (p *giteaProvider) repositoriesOf(reviewApp kubetempurav1.ReviewApp) []string {
+	return repositoriesOf(reviewApp, reviewApp.Spec.GiteaRepository)
+}
+
+func (p *giteaProvider) listFiles(context.Context, *pullRequestEvent) ([]string, error) {
+	return nil, nil
+}
+
+func (p *giteaProvider) teamMembers() teamMembers {
+	return nil
+}
+
+// newGiteaEvent returns the event of the payload. It returns errIgnoredEvent for an action which doesn't change the review apps.
+func newGiteaEvent(prp giteaPullRequestPayload) (*pullRequestEvent, error) {
+	if !(prp.Action == "opened" ||
+		prp.Action == "reopened" ||
+		prp.Action == "synchronized" ||
+		prp.Action == "edited" ||
+		prp.Action == "label_updated" ||
+		prp.Action == "label_cleared" ||
+		prp.Action == "closed") {
+		return nil, errIgnoredEvent
+	}
+	pr := pullRequest{
+		number:      strconv.FormatInt(prp.Number, 10),
+		headSHA:     prp.PullRequest.Head.SHA,
+		baseBranch:  prp.PullRequest.Base.Ref,
+		headBranch:  prp.PullRequest.Head.Ref,
+		fork:        prp.PullRequest.Head.RepoID != prp.PullRequest.Base.RepoID,
+		author:      prp.PullRequest.User.Login,
+		updatedAt:   prp.PullRequest.UpdatedAt,
+		repository:  prp.Repository.FullName,
+		host:        repositoryHost(prp.Repository.HTMLURL),
+		description: prp.PullRequest.Body,
+	}
+	for _, label := range prp.PullRequest.Labels {
+		pr.labels = append(pr.labels, label.Name)
+	}
+	if prp.Action == "label_updated" {
+		// The payload doesn't tell which labels were added. Only the users who can write the repository change the labels.
+		pr.addedLabels = pr.labels
+	}
+	return &pullRequestEvent{
+		repository:  prp.Repository.HTMLURL,
+		pullRequest: pr,
+		// E.g. a merged pull request is labeled. It must not create the review app again.
+		closed: prp.Action == "closed" || prp.PullRequest.State == "closed" || prp.PullRequest.Merged,
+	}, nil
+}
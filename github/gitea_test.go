@@ -0,0 +1,139 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	kubetempurav1 "github.com/mercari/kubetempura/api/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func giteaPayload(action string, sha string) string {
+	return fmt.Sprintf(`{
+		"action": %q,
+		"number": 1,
+		"pull_request": {
+			"user": {"login": "octocat"},
+			"labels": [{"name": "deploy"}],
+			"head": {"ref": "feature", "sha": %q, "repo_id": 2},
+			"base": {"ref": "main", "sha": "0000000", "repo_id": 1},
+			"updated_at": "2021-07-01T00:00:00Z"
+		},
+		"repository": {"html_url": "https://gitea.example.com/mercari/echo", "full_name": "mercari/echo"}
+	}`, action, sha)
+}
+
+func TestGiteaProviderParse(t *testing.T) {
+	p := &giteaProvider{}
+	tests := []struct {
+		name    string
+		event   string
+		body    string
+		wantErr error
+	}{
+		{name: "opened", event: "pull_request", body: giteaPayload("opened", "abcdefg")},
+		{name: "label updated", event: "pull_request", body: giteaPayload("label_updated", "abcdefg")},
+		{name: "assigned", event: "pull_request", body: giteaPayload("assigned", "abcdefg"), wantErr: errIgnoredEvent},
+		{name: "push", event: "push", body: `{}`, wantErr: errIgnoredEvent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, giteaPath, strings.NewReader(tt.body))
+			r.Header.Set("X-Gitea-Event", tt.event)
+			got, err := p.parse(r)
+			if err != tt.wantErr {
+				t.Fatalf("parse() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			pr := got.pullRequest
+			if got.repository != "https://gitea.example.com/mercari/echo" || pr.repository != "mercari/echo" || got.closed {
+				t.Fatalf("parse() = %+v", got)
+			}
+			if pr.number != "1" || pr.headSHA != "abcdefg" || pr.baseBranch != "main" || pr.headBranch != "feature" || pr.author != "octocat" {
+				t.Fatalf("pullRequest = %+v", pr)
+			}
+			if !pr.fork || !pr.hasLabel("deploy") || !pr.updatedAt.Equal(time.Date(2021, 7, 1, 0, 0, 0, 0, time.UTC)) {
+				t.Fatalf("pullRequest = %+v, want a pull request from a fork with the label", pr)
+			}
+		})
+	}
+}
+
+func TestGiteaProviderParseClosed(t *testing.T) {
+	p := &giteaProvider{}
+	tests := []struct {
+		name  string
+		patch string
+	}{
+		{name: "closed", patch: `"state": "closed",`},
+		{name: "merged", patch: `"merged": true,`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := strings.Replace(giteaPayload("label_updated", "abcdefg"), `"pull_request": {`, `"pull_request": {`+tt.patch, 1)
+			r := httptest.NewRequest(http.MethodPost, giteaPath, strings.NewReader(body))
+			r.Header.Set("X-Gitea-Event", "pull_request")
+			got, err := p.parse(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.closed {
+				t.Fatalf("closed = false, a label of a %s pull request must not deploy it", tt.name)
+			}
+		})
+	}
+}
+
+func TestGiteaWebhook(t *testing.T) {
+	echo := &kubetempurav1.ReviewApp{
+		ObjectMeta: metav1.ObjectMeta{Name: "echo", Namespace: "default"},
+		Spec:       kubetempurav1.ReviewAppSpec{GiteaRepository: "https://gitea.example.com/mercari/echo"},
+	}
+	c := newFakeClient(t, echo)
+	p, err := newGiteaProvider(nil, WebhookOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := newWebhookHandler(p, c, &webhookSecrets{client: c, static: testSecret}, WebhookOptions{Workers: 1, QueueSize: 10, Timeout: time.Second})
+	deliver := func(body string, secret string) int {
+		r := httptest.NewRequest(http.MethodPost, giteaPath, strings.NewReader(body))
+		r.Header.Set("X-Gitea-Event", "pull_request")
+		if secret != "" {
+			r.Header.Set("X-Gitea-Signature", strings.TrimPrefix(sign256(secret, body), "sha256="))
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		for h.events.queue.Len() != 0 {
+			h.events.processNext(context.Background())
+		}
+		return w.Code
+	}
+
+	if code := deliver(giteaPayload("opened", "abcdefg"), ""); code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want %d", code, http.StatusUnauthorized)
+	}
+	if code := deliver(giteaPayload("opened", "abcdefg"), "wrong"); code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want %d", code, http.StatusUnauthorized)
+	}
+	if code := deliver(giteaPayload("opened", "abcdefg"), testSecret); code != http.StatusAccepted {
+		t.Fatalf("status = %d, want %d", code, http.StatusAccepted)
+	}
+	prs, err := findPRs(context.Background(), *echo, "", "1", c)
+	if err != nil || len(prs) != 1 || prs[0].Spec.HeadCommitRef != "abcdefg" {
+		t.Fatalf("findPRs() = %v, %v, want the PR", prs, err)
+	}
+
+	if code := deliver(giteaPayload("closed", "abcdefg"), testSecret); code != http.StatusAccepted {
+		t.Fatalf("status = %d, want %d", code, http.StatusAccepted)
+	}
+	if prs, err := findPRs(context.Background(), *echo, "", "1", c); err != nil || len(prs) != 0 {
+		t.Fatalf("findPRs() = %v, %v, the closed PR must be deleted", prs, err)
+	}
+}
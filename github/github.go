@@ -0,0 +1,201 @@
+package github
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"github.com/go-playground/webhooks/v6/github"
+	kubetempurav1 "github.com/mercari/kubetempura/api/v1"
+)
+
+// githubProvider handles the webhooks of GitHub.
+type githubProvider struct {
+	// hook parses the payloads. It doesn't verify the signatures, because it accepts only a secret.
+	hook *github.Webhook
+	gh   *Client
+	// reportStatus enables the commit statuses of the review apps.
+	reportStatus bool
+}
+
+func newGitHubProvider(gh *Client, opts WebhookOptions) (provider, error) {
+	hook, err := github.New()
+	if err != nil {
+		return nil, err
+	}
+	return &githubProvider{hook: hook, gh: gh, reportStatus: opts.ReportStatus}, nil
+}
+
+func (p *githubProvider) name() string {
+	return providerGitHub
+}
+
+func (p *githubProvider) path() string {
+	return path
+}
+
+func (p *githubProvider) verify(header http.Header, payload []byte, secrets [][]byte) error {
+	return verifySignature(header, payload, secrets)
+}
+
+func (p *githubProvider) parse(r *http.Request) (*pullRequestEvent, error) {
+	// The parser doesn't support workflow_run, and its check_run lacks the pull requests of a run.
+	if event := r.Header.Get("X-GitHub-Event"); event == checkRunEvent || event == workflowRunEvent {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			return nil, err
+		}
+		return newCheckEvent(event, body)
+	}
+	payload, err := p.hook.Parse(r, github.PingEvent, github.PullRequestEvent, github.IssueCommentEvent)
+	if err == github.ErrEventNotFound {
+		return nil, errIgnoredEvent
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch payload := payload.(type) {
+	case github.PingPayload:
+		return nil, errPing
+	case github.PullRequestPayload:
+		return newGitHubEvent(payload)
+	case github.IssueCommentPayload:
+		return newCommentEvent(payload)
+	}
+	return nil, errIgnoredEvent
+}
+
+func (p *githubProvider) deliveryID(header http.Header) string {
+	return header.Get("X-GitHub-Delivery")
+}
+
+func (p *githubProvider) repositoriesOf(reviewApp kubetempurav1.ReviewApp) []string {
+	return repositoriesOf(reviewApp, reviewApp.Spec.GithubRepository)
+}
+
+func (p *githubProvider) listFiles(ctx context.Context, e *pullRequestEvent) ([]string, error) {
+	return p.gh.ListPullRequestFiles(ctx, e.pullRequest.repository, e.pullRequest.number)
+}
+
+func (p *githubProvider) teamMembers() teamMembers {
+	return p.gh
+}
+
+// report creates a commit status of the head commit, so the review app is linked from the pull request.
+func (p *githubProvider) report(ctx context.Context, e *pullRequestEvent, reviewApp kubetempurav1.ReviewApp) error {
+	if !p.reportStatus {
+		return nil
+	}
+	return p.gh.CreateCommitStatus(ctx, e.pullRequest.repository, e.pullRequest.headSHA, CommitStatus{
+		State:       "success",
+		Context:     "kubetempura/" + reviewApp.Name,
+		Description: "The review app is deployed to " + reviewApp.Namespace,
+	})
+}
+
+// checkPassed returns true when a check run or a workflow run of the name succeeded for the head commit.
+// A success of any run means the artifacts of the commit were built, even if a rerun failed later.
+func (p *githubProvider) checkPassed(ctx context.Context, e *pullRequestEvent, name string) (bool, error) {
+	checkRuns, err := p.gh.ListCheckRuns(ctx, e.pullRequest.repository, e.pullRequest.headSHA, name)
+	if err != nil {
+		return false, err
+	}
+	if hasSuccessfulRun(checkRuns, name) {
+		return true, nil
+	}
+	workflowRuns, err := p.gh.ListWorkflowRuns(ctx, e.pullRequest.repository, e.pullRequest.headSHA)
+	if err != nil {
+		return false, err
+	}
+	return hasSuccessfulRun(workflowRuns, name), nil
+}
+
+func hasSuccessfulRun(runs []CheckRun, name string) bool {
+	for _, run := range runs {
+		if run.Name == name && run.Conclusion == "success" {
+			return true
+		}
+	}
+	return false
+}
+
+// canRunCommand returns true when the commenter can push to the repository.
+func (p *githubProvider) canRunCommand(ctx context.Context, e *pullRequestEvent) (bool, error) {
+	permission, err := p.gh.GetCollaboratorPermission(ctx, e.pullRequest.repository, e.command.commenter)
+	if apiErr, ok := err.(*APIError); ok && apiErr.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return permission == "admin" || permission == "write", nil
+}
+
+func (p *githubProvider) getPullRequestEvent(ctx context.Context, e *pullRequestEvent) (*pullRequestEvent, error) {
+	prp, err := p.gh.GetPullRequest(ctx, e.pullRequest.repository, e.pullRequest.number)
+	if err != nil {
+		return nil, err
+	}
+	prp.Repository.HTMLURL = e.repository
+	prp.Repository.FullName = e.pullRequest.repository
+	return &pullRequestEvent{
+		repository:  e.repository,
+		pullRequest: newPullRequest(prp),
+		closed:      prp.PullRequest.State == "closed",
+		current:     true,
+	}, nil
+}
+
+// acknowledge reacts to the comment with +1 when the command was run, and -1 when it was denied.
+func (p *githubProvider) acknowledge(ctx context.Context, e *pullRequestEvent, accepted bool) error {
+	content := "+1"
+	if !accepted {
+		content = "-1"
+	}
+	return p.gh.CreateCommentReaction(ctx, e.pullRequest.repository, e.command.commentID, content)
+}
+
+// newGitHubEvent returns the event of the payload. It returns errIgnoredEvent for an action which doesn't change the review apps.
+func newGitHubEvent(prp github.PullRequestPayload) (*pullRequestEvent, error) {
+	if !(prp.Action == "opened" ||
+		prp.Action == "reopened" ||
+		prp.Action == "synchronize" ||
+		prp.Action == "edited" ||
+		prp.Action == "labeled" ||
+		prp.Action == "unlabeled" ||
+		prp.Action == "ready_for_review" ||
+		prp.Action == "converted_to_draft" ||
+		prp.Action == "closed") {
+		return nil, errIgnoredEvent
+	}
+	return &pullRequestEvent{
+		repository:  prp.Repository.HTMLURL,
+		pullRequest: newPullRequest(prp),
+		// E.g. a merged pull request is labeled. It must not create the review app again.
+		closed: prp.Action == "closed" || prp.PullRequest.State == "closed",
+	}, nil
+}
+
+// newCommentEvent returns the event of the command in a new comment of a pull request. It returns errIgnoredEvent for the other comments.
+func newCommentEvent(icp github.IssueCommentPayload) (*pullRequestEvent, error) {
+	// An issue comment is also sent for an issue which isn't a pull request.
+	if icp.Action != "created" || icp.Issue.PullRequest == nil {
+		return nil, errIgnoredEvent
+	}
+	cmd, ok := parseCommand(icp.Comment.Body)
+	if !ok {
+		return nil, errIgnoredEvent
+	}
+	cmd.commenter = icp.Comment.User.Login
+	cmd.commentID = icp.Comment.ID
+	return &pullRequestEvent{
+		repository: icp.Repository.HTMLURL,
+		pullRequest: pullRequest{
+			number:     strconv.FormatInt(icp.Issue.Number, 10),
+			repository: icp.Repository.FullName,
+			host:       repositoryHost(icp.Repository.HTMLURL),
+		},
+		command: cmd,
+	}, nil
+}
@@ -0,0 +1,94 @@
+package github
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/go-playground/webhooks/v6/github"
+	kubetempurav1 "github.com/mercari/kubetempura/api/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNewGitHubEvent(t *testing.T) {
+	tests := []struct {
+		action     string
+		state      string
+		wantClosed bool
+		wantErr    error
+	}{
+		{action: "opened", state: "open"},
+		{action: "ready_for_review", state: "open"},
+		{action: "closed", state: "closed", wantClosed: true},
+		{action: "labeled", state: "closed", wantClosed: true},
+		{action: "edited", state: "closed", wantClosed: true},
+		{action: "assigned", state: "open", wantErr: errIgnoredEvent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.action+" "+tt.state, func(t *testing.T) {
+			var prp github.PullRequestPayload
+			prp.Action = tt.action
+			prp.PullRequest.State = tt.state
+			prp.Number = 1
+			prp.Repository.HTMLURL = "https://github.com/mercari/kubetempura"
+			prp.Repository.FullName = "mercari/kubetempura"
+			got, err := newGitHubEvent(prp)
+			if err != tt.wantErr {
+				t.Fatalf("newGitHubEvent() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got.repository != prp.Repository.HTMLURL || got.pullRequest.repository != prp.Repository.FullName || got.pullRequest.number != "1" || got.closed != tt.wantClosed {
+				t.Fatalf("newGitHubEvent() = %+v", got)
+			}
+		})
+	}
+}
+
+func TestGitHubProviderReport(t *testing.T) {
+	var statuses int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/repos/mercari/kubetempura/statuses/abcdefg" {
+			http.NotFound(w, r)
+			return
+		}
+		atomic.AddInt32(&statuses, 1)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	reviewApp := &kubetempurav1.ReviewApp{
+		ObjectMeta: metav1.ObjectMeta{Name: "echo", Namespace: "default"},
+		Spec:       kubetempurav1.ReviewAppSpec{GithubRepository: "https://github.com/mercari/kubetempura"},
+	}
+	e := &pullRequestEvent{
+		repository:  "https://github.com/mercari/kubetempura",
+		pullRequest: pullRequest{number: "1", headSHA: "abcdefg", repository: "mercari/kubetempura"},
+	}
+	tests := []struct {
+		name         string
+		reportStatus bool
+		want         int32
+	}{
+		{name: "disabled", reportStatus: false, want: 0},
+		{name: "enabled", reportStatus: true, want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			atomic.StoreInt32(&statuses, 0)
+			p, err := newGitHubProvider(NewClient(server.URL, ""), WebhookOptions{ReportStatus: tt.reportStatus})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := handlePullRequest(context.Background(), p, e, "", newFakeClient(t, reviewApp)); err != nil {
+				t.Fatal(err)
+			}
+			if got := atomic.LoadInt32(&statuses); got != tt.want {
+				t.Fatalf("statuses = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package github
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-playground/webhooks/v6/gitlab"
+	kubetempurav1 "github.com/mercari/kubetempura/api/v1"
+)
+
+// gitlabPath is the path of the shared endpoint for GitLab. It isn't under /webhooks not to conflict with the endpoints of the namespaces.
+const gitlabPath = "/gitlab/webhooks"
+
+var (
+	errNoSecretTokens = errors.New("no secret tokens of GitLab are configured")
+	errMissingToken   = errors.New("missing X-Gitlab-Token Header")
+	errInvalidToken   = errors.New("X-Gitlab-Token validation failed")
+)
+
+// gitlabProvider handles the webhooks of GitLab. A merge request is handled as a pull request.
+// The changed files and the author are not in the payload, so the paths filters never match.
+// The events are ignored for the ReviewApps with the author filters. See hasAuthorFilter.
+type gitlabProvider struct {
+	// hook parses the payloads. It doesn't verify the tokens, because it accepts only a secret.
+	hook *gitlab.Webhook
+}
+
+func newGitLabProvider(_ *Client, _ WebhookOptions) (provider, error) {
+	hook, err := gitlab.New()
+	if err != nil {
+		return nil, err
+	}
+	return &gitlabProvider{hook: hook}, nil
+}
+
+func (p *gitlabProvider) name() string {
+	return providerGitLab
+}
+
+func (p *gitlabProvider) path() string {
+	return gitlabPath
+}
+
+// verify compares X-Gitlab-Token with the secrets. GitLab sends the secret token as it is instead of a signature.
+func (p *gitlabProvider) verify(header http.Header, _ []byte, secrets [][]byte) error {
+	return verifyToken(header.Get("X-Gitlab-Token"), secrets)
+}
+
+func (p *gitlabProvider) parse(r *http.Request) (*pullRequestEvent, error) {
+	payload, err := p.hook.Parse(r, gitlab.MergeRequestEvents)
+	if err == gitlab.ErrEventNotFound {
+		return nil, errIgnoredEvent
+	}
+	if err != nil {
+		return nil, err
+	}
+	if payload, ok := payload.(gitlab.MergeRequestEventPayload); ok {
+		return newGitLabEvent(payload)
+	}
+	return nil, errIgnoredEvent
+}
+
+func (p *gitlabProvider) deliveryID(header http.Header) string {
+	return header.Get("X-Gitlab-Event-UUID")
+}
+
+func (p *gitlabProvider) repositoriesOf(reviewApp kubetempurav1.ReviewApp) []string {
+	return repositoriesOf(reviewApp, reviewApp.Spec.GitlabRepository)
+}
+
+func (p *gitlabProvider) listFiles(context.Context, *pullRequestEvent) ([]string, error) {
+	return nil, nil
+}
+
+func (p *gitlabProvider) teamMembers() teamMembers {
+	return nil
+}
+
+// verifyToken returns nil when the token is one of the secrets. It rejects any token without the secrets, because the token isn't a signature.
+func verifyToken(token string, secrets [][]byte) error {
+	if len(secrets) == 0 {
+		return errNoSecretTokens
+	}
+	if token == "" {
+		return errMissingToken
+	}
+	for _, secret := range secrets {
+		if subtle.ConstantTimeCompare([]byte(token), secret) == 1 {
+			return nil
+		}
+	}
+	return errInvalidToken
+}
+
+// newGitLabEvent returns the event of the merge request. It returns errIgnoredEvent for an action which doesn't change the review apps.
+func newGitLabEvent(mrp gitlab.MergeRequestEventPayload) (*pullRequestEvent, error) {
+	action := mrp.ObjectAttributes.Action
+	if !(action == "open" ||
+		action == "reopen" ||
+		action == "update" ||
+		action == "merge" ||
+		action == "close") {
+		return nil, errIgnoredEvent
+	}
+	return &pullRequestEvent{
+		repository:  mrp.Project.WebURL,
+		pullRequest: newMergeRequest(mrp),
+		// E.g. a merged merge request is updated. It must not create the review app again.
+		closed: action == "merge" || action == "close" || mrp.ObjectAttributes.State == "closed" || mrp.ObjectAttributes.State == "merged",
+	}, nil
+}
+
+// newMergeRequest returns the state of the merge request as a pull request.
+func newMergeRequest(mrp gitlab.MergeRequestEventPayload) pullRequest {
+	attrs := mrp.ObjectAttributes
+	pr := pullRequest{
+		number:      strconv.FormatInt(attrs.IID, 10),
+		headSHA:     attrs.LastCommit.ID,
+		baseBranch:  attrs.TargetBranch,
+		headBranch:  attrs.SourceBranch,
+		draft:       attrs.WorkInProgress,
+		fork:        attrs.SourceProjectID != attrs.TargetProjectID,
+		updatedAt:   attrs.UpdatedAt.Time,
+		repository:  mrp.Project.PathWithNamespace,
+		host:        repositoryHost(mrp.Project.WebURL),
+		description: attrs.Description,
+	}
+	for _, label := range mrp.Labels {
+		pr.labels = append(pr.labels, label.Title)
+	}
+	previous := map[string]bool{}
+	for _, label := range mrp.Changes.LabelChanges.Previous {
+		previous[label.Title] = true
+	}
+	for _, label := range mrp.Changes.LabelChanges.Current {
+		if !previous[label.Title] {
+			pr.addedLabels = append(pr.addedLabels, label.Title)
+		}
+	}
+	return pr
+}
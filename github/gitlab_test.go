@@ -0,0 +1,179 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-playground/webhooks/v6/gitlab"
+	kubetempurav1 "github.com/mercari/kubetempura/api/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestVerifyToken(t *testing.T) {
+	secrets := [][]byte{[]byte("old"), []byte("new")}
+	tests := []struct {
+		name    string
+		token   string
+		secrets [][]byte
+		wantErr error
+	}{
+		{name: "no secrets", token: "", wantErr: errNoSecretTokens},
+		{name: "no secrets with a token", token: "old", wantErr: errNoSecretTokens},
+		{name: "old secret", token: "old", secrets: secrets},
+		{name: "new secret", token: "new", secrets: secrets},
+		{name: "missing token", token: "", secrets: secrets, wantErr: errMissingToken},
+		{name: "unknown token", token: "wrong", secrets: secrets, wantErr: errInvalidToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := verifyToken(tt.token, tt.secrets); err != tt.wantErr {
+				t.Fatalf("verifyToken() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func mergeRequestPayload(action string, sha string) string {
+	return fmt.Sprintf(`{
+		"object_kind": "merge_request",
+		"user": {"username": "octocat"},
+		"project": {"web_url": "https://gitlab.example.com/mercari/echo"},
+		"object_attributes": {
+			"iid": 1,
+			"action": %q,
+			"source_branch": "feature",
+			"target_branch": "main",
+			"source_project_id": 2,
+			"target_project_id": 1,
+			"work_in_progress": true,
+			"updated_at": "2021-07-01 00:00:00 UTC",
+			"last_commit": {"id": %q}
+		},
+		"labels": [{"title": "deploy"}]
+	}`, action, sha)
+}
+
+func TestNewMergeRequest(t *testing.T) {
+	hook, _ := gitlab.New()
+	r := httptest.NewRequest(http.MethodPost, gitlabPath, strings.NewReader(mergeRequestPayload("open", "abcdefg")))
+	r.Header.Set("X-Gitlab-Event", string(gitlab.MergeRequestEvents))
+	payload, err := hook.Parse(r, gitlab.MergeRequestEvents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := newMergeRequest(payload.(gitlab.MergeRequestEventPayload))
+	if got.number != "1" || got.headSHA != "abcdefg" || got.baseBranch != "main" || got.headBranch != "feature" {
+		t.Fatalf("newMergeRequest() = %+v", got)
+	}
+	if !got.draft || !got.fork || !got.hasLabel("deploy") {
+		t.Fatalf("newMergeRequest() = %+v, want a draft from a fork with the label", got)
+	}
+	if !got.updatedAt.Equal(time.Date(2021, 7, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("updatedAt = %v", got.updatedAt)
+	}
+}
+
+func TestNewGitLabEvent(t *testing.T) {
+	tests := []struct {
+		action     string
+		state      string
+		wantClosed bool
+		wantErr    error
+	}{
+		{action: "open", state: "opened"},
+		{action: "update", state: "opened"},
+		{action: "merge", state: "merged", wantClosed: true},
+		{action: "update", state: "merged", wantClosed: true},
+		{action: "update", state: "closed", wantClosed: true},
+		{action: "approved", state: "opened", wantErr: errIgnoredEvent},
+	}
+	hook, _ := gitlab.New()
+	for _, tt := range tests {
+		t.Run(tt.action+" "+tt.state, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, gitlabPath, strings.NewReader(mergeRequestPayload(tt.action, "abcdefg")))
+			r.Header.Set("X-Gitlab-Event", string(gitlab.MergeRequestEvents))
+			payload, err := hook.Parse(r, gitlab.MergeRequestEvents)
+			if err != nil {
+				t.Fatal(err)
+			}
+			mrp := payload.(gitlab.MergeRequestEventPayload)
+			mrp.ObjectAttributes.State = tt.state
+			got, err := newGitLabEvent(mrp)
+			if err != tt.wantErr {
+				t.Fatalf("newGitLabEvent() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && got.closed != tt.wantClosed {
+				t.Fatalf("closed = %v, want %v", got.closed, tt.wantClosed)
+			}
+		})
+	}
+}
+
+func TestGitLabWebhook(t *testing.T) {
+	echo := &kubetempurav1.ReviewApp{
+		ObjectMeta: metav1.ObjectMeta{Name: "echo", Namespace: "default"},
+		Spec:       kubetempurav1.ReviewAppSpec{GitlabRepository: "https://gitlab.example.com/mercari/echo"},
+	}
+	// The same URL on GitHub is another repository.
+	github := &kubetempurav1.ReviewApp{
+		ObjectMeta: metav1.ObjectMeta{Name: "github", Namespace: "default"},
+		Spec:       kubetempurav1.ReviewAppSpec{GithubRepository: "https://gitlab.example.com/mercari/echo"},
+	}
+	c := newFakeClient(t, echo, github)
+	p, err := newGitLabProvider(nil, WebhookOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := newWebhookHandler(p, c, &webhookSecrets{client: c, static: testSecret}, WebhookOptions{Workers: 1, QueueSize: 10, Timeout: time.Second})
+	deliver := func(body string, token string) int {
+		r := httptest.NewRequest(http.MethodPost, gitlabPath, strings.NewReader(body))
+		r.Header.Set("X-Gitlab-Event", string(gitlab.MergeRequestEvents))
+		r.Header.Set("X-Gitlab-Token", token)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		for h.events.queue.Len() != 0 {
+			h.events.processNext(context.Background())
+		}
+		return w.Code
+	}
+
+	if code := deliver(mergeRequestPayload("open", "abcdefg"), "wrong"); code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want %d", code, http.StatusUnauthorized)
+	}
+	if code := deliver(mergeRequestPayload("open", "abcdefg"), testSecret); code != http.StatusAccepted {
+		t.Fatalf("status = %d, want %d", code, http.StatusAccepted)
+	}
+	prs, err := findPRs(context.Background(), *echo, "", "1", c)
+	if err != nil || len(prs) != 1 || prs[0].Spec.HeadCommitRef != "abcdefg" {
+		t.Fatalf("findPRs() = %v, %v, want the PR", prs, err)
+	}
+	if prs, err := findPRs(context.Background(), *github, "", "1", c); err != nil || len(prs) != 0 {
+		t.Fatalf("findPRs() = %v, %v, the ReviewApp for GitHub must not receive the event", prs, err)
+	}
+
+	// The author isn't in the payload, so a ReviewApp with the author filters ignores the event instead of deleting the PR.
+	echo.Spec.Authors.Allow.Users = []string{"octocat"}
+	if err := c.Update(context.Background(), echo); err != nil {
+		t.Fatal(err)
+	}
+	updated := strings.Replace(mergeRequestPayload("update", "hijklmn"), "2021-07-01 00:00:00", "2021-07-01 00:01:00", 1)
+	if code := deliver(updated, testSecret); code != http.StatusAccepted {
+		t.Fatalf("status = %d, want %d", code, http.StatusAccepted)
+	}
+	prs, err = findPRs(context.Background(), *echo, "", "1", c)
+	if err != nil || len(prs) != 1 || prs[0].Spec.HeadCommitRef != "abcdefg" {
+		t.Fatalf("findPRs() = %v, %v, want the PR kept as it is", prs, err)
+	}
+
+	if code := deliver(mergeRequestPayload("merge", "abcdefg"), testSecret); code != http.StatusAccepted {
+		t.Fatalf("status = %d, want %d", code, http.StatusAccepted)
+	}
+	if prs, err := findPRs(context.Background(), *echo, "", "1", c); err != nil || len(prs) != 0 {
+		t.Fatalf("findPRs() = %v, %v, the merged PR must be deleted", prs, err)
+	}
+}
@@ -0,0 +1,76 @@
+package github
+
+import (
+	"context"
+
+	kubetempurav1 "github.com/mercari/kubetempura/api/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// repositoryIndex is the field index of the ReviewApps by the keys of their repositories.
+	repositoryIndex = "repository"
+	// wildcardIndexValue is the key of a repository with wildcards. The ReviewApps with it are read for every event.
+	wildcardIndexValue = "*"
+)
+
+// IndexReviewApps adds the field index of the ReviewApps by the repositories to the cache. It must be called before the cache starts.
+func IndexReviewApps(ctx context.Context, indexer client.FieldIndexer) error {
+	return indexer.IndexField(ctx, &kubetempurav1.ReviewApp{}, repositoryIndex, repositoryIndexValues)
+}
+
+// repositoryIndexValues returns the keys of the repositories of all the providers of the ReviewApp.
+func repositoryIndexValues(obj client.Object) []string {
+	reviewApp, ok := obj.(*kubetempurav1.ReviewApp)
+	if !ok {
+		return nil
+	}
+	patterns := append([]string{reviewApp.Spec.GithubRepository, reviewApp.Spec.GitlabRepository, reviewApp.Spec.GiteaRepository}, reviewApp.Spec.Repositories...)
+	var ret []string
+	seen := map[string]bool{}
+	for _, pattern := range patterns {
+		key := wildcardIndexValue
+		if !isWildcard(pattern) {
+			key = repositoryKey(pattern)
+		}
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		ret = append(ret, key)
+	}
+	return ret
+}
+
+// repositoryKey returns the key of the repository in the index. It doesn't have the host, because a repository without a host matches any host.
+func repositoryKey(repository string) string {
+	_, path := parseRepository(repository)
+	return path
+}
+
+// getReviewAppsByRepository returns the ReviewApps which may match the repository from the index. An empty namespace means all namespaces.
+// The hosts and the providers of the repositories are not compared, so the caller filters them with findReviewAppsByRepository.
+func getReviewAppsByRepository(ctx context.Context, c client.Reader, namespace string, repository string) ([]kubetempurav1.ReviewApp, error) {
+	key := repositoryKey(repository)
+	if key == "" {
+		return nil, nil
+	}
+	var ret []kubetempurav1.ReviewApp
+	seen := map[types.NamespacedName]bool{}
+	for _, value := range []string{key, wildcardIndexValue} {
+		var reviewApps kubetempurav1.ReviewAppList
+		if err := c.List(ctx, &reviewApps, client.InNamespace(namespace), client.MatchingFields{repositoryIndex: value}); err != nil {
+			return nil, err
+		}
+		for _, reviewApp := range reviewApps.Items {
+			name := types.NamespacedName{Namespace: reviewApp.Namespace, Name: reviewApp.Name}
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			ret = append(ret, reviewApp)
+		}
+	}
+	return ret, nil
+}
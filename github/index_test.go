@@ -0,0 +1,87 @@
+package github
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	kubetempurav1 "github.com/mercari/kubetempura/api/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestRepositoryIndexValues(t *testing.T) {
+	reviewApp := &kubetempurav1.ReviewApp{
+		Spec: kubetempurav1.ReviewAppSpec{
+			GithubRepository: "https://github.com/mercari/echo",
+			GitlabRepository: "https://gitlab.example.com/mercari/group/echo",
+			Repositories:     []string{"git@github.com:Mercari/echo.git", "github.com/mercari/web-*", "github.com/kouzoh/*"},
+		},
+	}
+	got := repositoryIndexValues(reviewApp)
+	want := []string{"mercari/echo", "mercari/group/echo", wildcardIndexValue}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("repositoryIndexValues() = %v, want %v", got, want)
+	}
+}
+
+// indexedReader lists the ReviewApps with the field index like the cache, because the fake client ignores the field selectors.
+type indexedReader struct {
+	client.Client
+	lists int
+}
+
+func (r *indexedReader) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	r.lists++
+	if err := r.Client.List(ctx, list, opts...); err != nil {
+		return err
+	}
+	listOpts := client.ListOptions{}
+	listOpts.ApplyOptions(opts)
+	reviewApps, ok := list.(*kubetempurav1.ReviewAppList)
+	if !ok || listOpts.FieldSelector == nil {
+		return nil
+	}
+	value, _ := listOpts.FieldSelector.RequiresExactMatch(repositoryIndex)
+	var items []kubetempurav1.ReviewApp
+	for i := range reviewApps.Items {
+		for _, v := range repositoryIndexValues(&reviewApps.Items[i]) {
+			if v == value {
+				items = append(items, reviewApps.Items[i])
+				break
+			}
+		}
+	}
+	reviewApps.Items = items
+	return nil
+}
+
+func TestGetReviewAppsByRepository(t *testing.T) {
+	newReviewApp := func(name string, spec kubetempurav1.ReviewAppSpec) *kubetempurav1.ReviewApp {
+		return &kubetempurav1.ReviewApp{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"}, Spec: spec}
+	}
+	c := &indexedReader{Client: newFakeClient(t,
+		newReviewApp("echo", kubetempurav1.ReviewAppSpec{GithubRepository: "https://github.com/mercari/echo"}),
+		newReviewApp("ghe", kubetempurav1.ReviewAppSpec{GithubRepository: "https://ghe.example.com/Mercari/echo.git"}),
+		newReviewApp("org", kubetempurav1.ReviewAppSpec{Repositories: []string{"github.com/mercari/*", "mercari/echo"}}),
+		newReviewApp("web", kubetempurav1.ReviewAppSpec{GithubRepository: "https://github.com/mercari/web"}),
+	)}
+
+	reviewApps, err := getReviewAppsByRepository(context.Background(), c, "", "https://github.com/mercari/echo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, reviewApp := range reviewApps {
+		got = append(got, reviewApp.Name)
+	}
+	sort.Strings(got)
+	// The host of ghe is compared later by findReviewAppsByRepository.
+	if want := []string{"echo", "ghe", "org"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("getReviewAppsByRepository() = %v, want %v", got, want)
+	}
+	if c.lists != 2 {
+		t.Fatalf("lists = %d, want 2 lookups of the index", c.lists)
+	}
+}
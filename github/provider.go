@@ -0,0 +1,93 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+
+	kubetempurav1 "github.com/mercari/kubetempura/api/v1"
+)
+
+const (
+	providerGitHub = "github"
+	providerGitLab = "gitlab"
+	providerGitea  = "gitea"
+)
+
+var (
+	// errIgnoredEvent means the event isn't handled by KubeTempura.
+	errIgnoredEvent = errors.New("the event is ignored")
+	// errPing means the event is a ping, which is sent when a webhook is created.
+	errPing = errors.New("ping")
+)
+
+// provider parses the webhooks of a Git hosting service into the events of pull requests.
+// The handler verifies, deduplicates and queues the events, and then creates, updates or deletes the PRs in the same way for all the providers.
+type provider interface {
+	// name is used in the logs, the metrics and --webhook-providers. E.g. github
+	name() string
+	// path is the path of the shared endpoint. The endpoint of a namespace is under it. E.g. /webhooks/my-team
+	path() string
+	// verify returns nil when the request is signed with one of the secrets.
+	verify(header http.Header, payload []byte, secrets [][]byte) error
+	// parse returns the event of a pull request. It returns errIgnoredEvent for an event which isn't handled, and errPing for a ping.
+	parse(r *http.Request) (*pullRequestEvent, error)
+	// deliveryID returns the ID of the delivery to ignore the redeliveries. It may be empty.
+	deliveryID(header http.Header) string
+	// repositoriesOf returns the patterns of the repositories of the ReviewApp on the provider. See matchRepository.
+	repositoriesOf(reviewApp kubetempurav1.ReviewApp) []string
+	// listFiles returns the changed files of the pull request. A provider which can't list them returns nothing, so no files match the paths filters.
+	listFiles(ctx context.Context, e *pullRequestEvent) ([]string, error)
+	// teamMembers returns the members of the teams in the author filters. It's nil when the provider has no teams.
+	teamMembers() teamMembers
+}
+
+// reporter is implemented by a provider which reports the review apps to the pull requests. E.g. as commit statuses
+type reporter interface {
+	// report tells the pull request that the PR of the ReviewApp was created or updated.
+	report(ctx context.Context, e *pullRequestEvent, reviewApp kubetempurav1.ReviewApp) error
+}
+
+// pullRequestEvent is an event of a pull request normalized from the webhook of a provider.
+type pullRequestEvent struct {
+	// repository is the URL of the repository. E.g. https://github.com/mercari/kubetempura
+	repository  string
+	pullRequest pullRequest
+	// closed is true when the pull request is closed or merged.
+	closed bool
+	// command is the command in a comment of the pull request. The pull request has only the number and the repository then.
+	command *command
+	// check is the successful check of a commit. The pull request has only the repository then.
+	check *checkResult
+	// sharedEndpoint is true when the event was delivered to the shared endpoint. The ReviewApps with their own endpoints ignore it.
+	sharedEndpoint bool
+	// current is true when the pull request was read from the API. A payload may be delivered after the pull request was closed.
+	current bool
+}
+
+// providers are the constructors of the providers by name. gh is the client of the GitHub REST API.
+var providers = map[string]func(gh *Client, opts WebhookOptions) (provider, error){
+	providerGitHub: newGitHubProvider,
+	providerGitLab: newGitLabProvider,
+	providerGitea:  newGiteaProvider,
+}
+
+// ProviderNames returns the names of the supported providers.
+func ProviderNames() []string {
+	var names []string
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func newProvider(name string, gh *Client, opts WebhookOptions) (provider, error) {
+	newFunc, ok := providers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown provider %q. It must be one of %v", name, ProviderNames())
+	}
+	return newFunc(gh, opts)
+}
@@ -0,0 +1,104 @@
+package github
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/workqueue"
+)
+
+const (
+	// maxEventRetries is the number of the retries of a failed event. The backoff reaches maxEventBackoff after about 8 retries.
+	maxEventRetries = 10
+	minEventBackoff = time.Second
+	maxEventBackoff = 5 * time.Minute
+)
+
+// event is a webhook to be processed by the queue.
+type event struct {
+	delivery string
+	// namespace is the namespace of the endpoint which received the event. It's empty for the shared endpoint.
+	namespace   string
+	pullRequest *pullRequestEvent
+}
+
+// eventQueue processes the events in the workers. A failed event is retried with an exponential backoff.
+type eventQueue struct {
+	queue   workqueue.RateLimitingInterface
+	size    int
+	workers int
+	// timeout is the time limit of each try of an event.
+	timeout time.Duration
+	handle  func(ctx context.Context, e *event) error
+	// giveUp is called when an event failed too many times.
+	giveUp func(e *event)
+
+	// mu makes the check of the size and the addition atomic.
+	mu sync.Mutex
+}
+
+// newEventQueue returns a queue. The name is used in the metrics.
+func newEventQueue(name string, size int, workers int, timeout time.Duration, handle func(ctx context.Context, e *event) error) *eventQueue {
+	return &eventQueue{
+		queue:   workqueue.NewNamedRateLimitingQueue(workqueue.NewItemExponentialFailureRateLimiter(minEventBackoff, maxEventBackoff), name),
+		size:    size,
+		workers: workers,
+		timeout: timeout,
+		handle:  handle,
+		giveUp:  func(e *event) {},
+	}
+}
+
+// add enqueues the event. It returns false when the queue is full.
+// The events waiting for the retries are not counted, so a burst of new events is still accepted.
+func (q *eventQueue) add(e *event) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.queue.Len() >= q.size {
+		return false
+	}
+	// The pointer is the key of the queue, so each event is processed even if it has the same payload as another.
+	q.queue.Add(e)
+	return true
+}
+
+// run starts the workers, and blocks until the context is done.
+func (q *eventQueue) run(ctx context.Context) {
+	defer q.queue.ShutDown()
+	for i := 0; i < q.workers; i++ {
+		go wait.UntilWithContext(ctx, func(ctx context.Context) {
+			for q.processNext(ctx) {
+			}
+		}, time.Second)
+	}
+	<-ctx.Done()
+}
+
+// processNext processes an event. It returns false when the queue is shut down.
+func (q *eventQueue) processNext(ctx context.Context) bool {
+	item, shutdown := q.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer q.queue.Done(item)
+	e := item.(*event)
+
+	tryCtx, cancel := context.WithTimeout(ctx, q.timeout)
+	err := q.handle(tryCtx, e)
+	cancel()
+	if err == nil {
+		q.queue.Forget(item)
+		return true
+	}
+	if q.queue.NumRequeues(item) < maxEventRetries {
+		log.Error(err, "Failed to handle the event. Retrying.", "delivery", e.delivery, "retries", q.queue.NumRequeues(item))
+		q.queue.AddRateLimited(item)
+		return true
+	}
+	log.Error(err, "Gave up the event", "delivery", e.delivery)
+	q.queue.Forget(item)
+	q.giveUp(e)
+	return true
+}
@@ -0,0 +1,83 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/util/workqueue"
+)
+
+func newTestEventQueue(size int, handle func(ctx context.Context, e *event) error) *eventQueue {
+	q := newEventQueue("test", size, 1, time.Second, handle)
+	// Retry without waiting.
+	q.queue = workqueue.NewRateLimitingQueue(workqueue.NewItemExponentialFailureRateLimiter(time.Millisecond, time.Millisecond))
+	return q
+}
+
+func TestEventQueue(t *testing.T) {
+	t.Run("retries a failed event", func(t *testing.T) {
+		var calls int32
+		done := make(chan struct{})
+		q := newTestEventQueue(1, func(ctx context.Context, e *event) error {
+			if _, ok := ctx.Deadline(); !ok {
+				t.Errorf("the context must have a deadline")
+			}
+			if atomic.AddInt32(&calls, 1) < 3 {
+				return errors.New("transient error")
+			}
+			close(done)
+			return nil
+		})
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go q.run(ctx)
+
+		if !q.add(&event{delivery: "1"}) {
+			t.Fatal("add() must accept the event")
+		}
+		select {
+		case <-done:
+		case <-time.After(10 * time.Second):
+			t.Fatalf("the event was tried %d times, want 3", atomic.LoadInt32(&calls))
+		}
+	})
+
+	t.Run("gives up an event", func(t *testing.T) {
+		var calls int32
+		gaveUp := make(chan *event, 1)
+		q := newTestEventQueue(1, func(ctx context.Context, e *event) error {
+			atomic.AddInt32(&calls, 1)
+			return errors.New("permanent error")
+		})
+		q.giveUp = func(e *event) { gaveUp <- e }
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go q.run(ctx)
+
+		q.add(&event{delivery: "1"})
+		select {
+		case e := <-gaveUp:
+			if e.delivery != "1" {
+				t.Fatalf("gave up %v, want 1", e.delivery)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatal("the event must be given up")
+		}
+		if got := atomic.LoadInt32(&calls); got != maxEventRetries+1 {
+			t.Fatalf("the event was tried %d times, want %d", got, maxEventRetries+1)
+		}
+	})
+
+	t.Run("rejects an event when full", func(t *testing.T) {
+		q := newTestEventQueue(1, func(ctx context.Context, e *event) error { return nil })
+		if !q.add(&event{delivery: "1"}) {
+			t.Fatal("add() must accept the first event")
+		}
+		if q.add(&event{delivery: "2"}) {
+			t.Fatal("add() must reject the event when the queue is full")
+		}
+	})
+}
@@ -0,0 +1,108 @@
+package github
+
+import (
+	"net/url"
+	pathpkg "path"
+	"strings"
+
+	kubetempurav1 "github.com/mercari/kubetempura/api/v1"
+)
+
+// parseRepository returns the host and the path of a repository in lower case. The host is empty when the repository has none.
+// It accepts an HTTPS URL, an SSH URL, HOST/OWNER/NAME and OWNER/NAME. E.g. git@github.com:mercari/kubetempura.git
+func parseRepository(repository string) (string, string) {
+	s := strings.ToLower(strings.TrimSpace(repository))
+	var host, path string
+	if strings.Contains(s, "://") {
+		u, err := url.Parse(s)
+		if err != nil {
+			return "", ""
+		}
+		host, path = u.Host, u.Path
+	} else if at, colon := strings.Index(s, "@"), strings.Index(s, ":"); at >= 0 && colon > at {
+		// The scp-like syntax of SSH. E.g. git@github.com:mercari/kubetempura.git
+		host, path = s[at+1:colon], s[colon+1:]
+	} else {
+		path = s
+		// An owner can't have a dot, so the first segment with a dot is a host. E.g. github.com/mercari/kubetempura
+		if i := strings.Index(s, "/"); i > 0 && strings.ContainsAny(s[:i], ".:") {
+			host, path = s[:i], s[i+1:]
+		}
+	}
+	path = strings.Trim(strings.TrimSuffix(strings.Trim(path, "/"), ".git"), "/")
+	return host, path
+}
+
+// matchRepository returns true when the repository matches the pattern.
+// The case, the scheme, a trailing slash and .git are ignored. A pattern without a host matches the repository on any host.
+// A segment of the pattern can have the wildcards of path.Match. E.g. github.com/mercari/*
+func matchRepository(pattern string, repository string) bool {
+	patternHost, patternPath := parseRepository(pattern)
+	host, path := parseRepository(repository)
+	if patternPath == "" || path == "" {
+		return false
+	}
+	if patternHost != "" && host != "" {
+		if ok, err := pathpkg.Match(patternHost, host); err != nil || !ok {
+			return false
+		}
+	}
+	ok, err := pathpkg.Match(patternPath, path)
+	return err == nil && ok
+}
+
+// matchAnyRepository returns true when the repository matches one of the patterns.
+func matchAnyRepository(patterns []string, repository string) bool {
+	for _, pattern := range patterns {
+		if matchRepository(pattern, repository) {
+			return true
+		}
+	}
+	return false
+}
+
+// repositoriesOf returns the repository of the provider and the repositories of any provider of the ReviewApp.
+func repositoriesOf(reviewApp kubetempurav1.ReviewApp, repository string) []string {
+	if repository == "" {
+		return reviewApp.Spec.Repositories
+	}
+	return append([]string{repository}, reviewApp.Spec.Repositories...)
+}
+
+// isWildcard returns true when the pattern can match more than a repository.
+func isWildcard(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[")
+}
+
+// hasManyRepositories returns true when the ReviewApp can receive the pull requests of more than a repository.
+// The numbers of the pull requests are not unique then, so the names of the PRs have the repositories.
+func hasManyRepositories(reviewApp kubetempurav1.ReviewApp) bool {
+	if len(reviewApp.Spec.Repositories) != 0 {
+		return true
+	}
+	return isWildcard(reviewApp.Spec.GithubRepository) || isWildcard(reviewApp.Spec.GitlabRepository) || isWildcard(reviewApp.Spec.GiteaRepository)
+}
+
+// repositoryHost returns the host of the URL of a repository. E.g. github.com
+func repositoryHost(repository string) string {
+	host, _ := parseRepository(repository)
+	return host
+}
+
+// repositoryID returns HOST/OWNER/NAME in lower case. The host is omitted when it's unknown.
+func repositoryID(host string, fullName string) string {
+	if host == "" {
+		return strings.ToLower(fullName)
+	}
+	return strings.ToLower(host + "/" + fullName)
+}
+
+// sameRepository returns true when the IDs are of the same repository. An ID without a host matches the repository on any host.
+func sameRepository(a string, b string) bool {
+	hostA, pathA := parseRepository(a)
+	hostB, pathB := parseRepository(b)
+	if hostA != "" && hostB != "" && hostA != hostB {
+		return false
+	}
+	return pathA == pathB
+}
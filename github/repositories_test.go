@@ -0,0 +1,89 @@
+package github
+
+import (
+	"context"
+	"testing"
+
+	kubetempurav1 "github.com/mercari/kubetempura/api/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestMatchRepository(t *testing.T) {
+	tests := []struct {
+		pattern    string
+		repository string
+		want       bool
+	}{
+		{pattern: "https://github.com/mercari/kubetempura", repository: "https://github.com/mercari/kubetempura", want: true},
+		{pattern: "https://github.com/mercari/kubetempura/", repository: "https://github.com/mercari/kubetempura", want: true},
+		{pattern: "https://github.com/Mercari/KubeTempura.git", repository: "https://github.com/mercari/kubetempura", want: true},
+		{pattern: "git@github.com:mercari/kubetempura.git", repository: "https://github.com/mercari/kubetempura", want: true},
+		{pattern: "ssh://git@github.com/mercari/kubetempura.git", repository: "https://github.com/mercari/kubetempura", want: true},
+		{pattern: "github.com/mercari/kubetempura", repository: "https://github.com/mercari/kubetempura", want: true},
+		{pattern: "mercari/kubetempura", repository: "https://ghe.example.com/mercari/kubetempura", want: true},
+		{pattern: "github.com/mercari/*", repository: "https://github.com/mercari/kubetempura", want: true},
+		{pattern: "*/kubetempura", repository: "https://github.com/mercari/kubetempura", want: true},
+		{pattern: "https://ghe.example.com/mercari/kubetempura", repository: "https://github.com/mercari/kubetempura", want: false},
+		{pattern: "github.com/mercari/*", repository: "https://github.com/kouzoh/kubetempura", want: false},
+		{pattern: "github.com/mercari/*", repository: "https://gitlab.example.com/mercari/group/echo", want: false},
+		{pattern: "mercari/kubetempura", repository: "https://github.com/mercari/kubetempura-ui", want: false},
+		{pattern: "", repository: "https://github.com/mercari/kubetempura", want: false},
+	}
+	for _, tt := range tests {
+		if got := matchRepository(tt.pattern, tt.repository); got != tt.want {
+			t.Errorf("matchRepository(%q, %q) = %v, want %v", tt.pattern, tt.repository, got, tt.want)
+		}
+	}
+}
+
+func TestSameRepository(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{a: "github.com/mercari/kubetempura", b: "github.com/Mercari/Kubetempura", want: true},
+		{a: "github.com/mercari/kubetempura", b: "gitlab.com/mercari/kubetempura", want: false},
+		{a: "mercari/kubetempura", b: "gitlab.com/mercari/kubetempura", want: true},
+		{a: "github.com/a/b-c", b: "github.com/a-b/c", want: false},
+	}
+	for _, tt := range tests {
+		if got := sameRepository(tt.a, tt.b); got != tt.want {
+			t.Errorf("sameRepository(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestHandlePullRequestManyRepositories(t *testing.T) {
+	org := &kubetempurav1.ReviewApp{
+		ObjectMeta: metav1.ObjectMeta{Name: "org", Namespace: "default"},
+		Spec:       kubetempurav1.ReviewAppSpec{Repositories: []string{"github.com/mercari/*", "github.com/mercari-web/api", "gitlab.com/mercari/web"}},
+	}
+	c := newFakeClient(t, org)
+	p, err := newGitHubProvider(NewClient("http://localhost", ""), WebhookOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The names of a/b-c and a-b/c are the same when the slashes are replaced. The same repository can be on GitHub and GitLab.
+	repositories := []string{"github.com/mercari/web", "github.com/mercari/web-api", "github.com/mercari-web/api", "gitlab.com/mercari/web"}
+	for _, repository := range repositories {
+		host, fullName := parseRepository(repository)
+		e := &pullRequestEvent{
+			repository:  "https://" + repository,
+			pullRequest: pullRequest{number: "1", headSHA: repository, repository: fullName, host: host},
+		}
+		if err := handlePullRequest(context.Background(), p, e, "", c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The pull requests of the same number in the different repositories have their own PRs.
+	for _, repository := range repositories {
+		prs, err := findPRs(context.Background(), *org, repository, "1", c)
+		if err != nil || len(prs) != 1 || prs[0].Spec.HeadCommitRef != repository {
+			t.Fatalf("findPRs(%s) = %v, %v, want the PR", repository, prs, err)
+		}
+		if want := "org-" + shortHash(repository) + "-pr1"; prs[0].Name != want || prs[0].Spec.Repository != repository {
+			t.Fatalf("PR = %v %v, want %v %v", prs[0].Name, prs[0].Spec.Repository, want, repository)
+		}
+	}
+}
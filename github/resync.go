@@ -0,0 +1,161 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	kubetempurav1 "github.com/mercari/kubetempura/api/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Resyncer periodically compares the PRs with the open pull requests on GitHub to recover the missed webhooks.
+// It's added to the manager, so it runs only in the leader.
+type Resyncer struct {
+	Client   client.Client
+	GitHub   *Client
+	Interval time.Duration
+}
+
+// Start runs the resync every interval until the context is done.
+func (r *Resyncer) Start(ctx context.Context) error {
+	log.Info("Resync started", "interval", r.Interval)
+	wait.UntilWithContext(ctx, r.resync, r.Interval)
+	return nil
+}
+
+// NeedLeaderElection returns true not to create and delete the same PRs in multiple replicas.
+func (r *Resyncer) NeedLeaderElection() bool {
+	return true
+}
+
+func (r *Resyncer) resync(ctx context.Context) {
+	reviewApps, err := getReviewApps(ctx, r.Client, "")
+	if err != nil {
+		log.Error(err, "Failed to get ReviewApps")
+		return
+	}
+	defaultHost := githubHost(r.GitHub.BaseURL)
+	// The ReviewApps are grouped by the hosts and the full names, because the same repository can be written in the different forms.
+	type repositoryKey struct{ host, fullName string }
+	repositories := map[repositoryKey][]kubetempurav1.ReviewApp{}
+	for _, reviewApp := range reviewApps {
+		for _, repository := range githubRepositoriesOf(reviewApp, defaultHost) {
+			// The repositories matching a wildcard are unknown.
+			if isWildcard(repository) {
+				continue
+			}
+			fullName, err := repositoryFullName(repository)
+			if err != nil {
+				log.Error(err, "Failed to resync the repository", "reviewApp", reviewApp.Name)
+				continue
+			}
+			key := repositoryKey{host: repositoryHost(repository), fullName: fullName}
+			if key.host == "" {
+				key.host = defaultHost
+			}
+			// A ReviewApp can have the same repository in githubRepository and repositories.
+			if n := len(repositories[key]); n != 0 && repositories[key][n-1].Name == reviewApp.Name && repositories[key][n-1].Namespace == reviewApp.Namespace {
+				continue
+			}
+			repositories[key] = append(repositories[key], reviewApp)
+		}
+	}
+	for key, reviewApps := range repositories {
+		if err := r.resyncRepository(ctx, key.host, key.fullName, reviewApps); err != nil {
+			log.Error(err, "Failed to resync the repository", "repository", key.fullName)
+		}
+	}
+}
+
+// githubRepositoriesOf returns githubRepository and the repositories of the ReviewApp on the host of GitHub.
+// A ReviewApp for another provider has none. A repository without a host is of any provider, so it's resynced on GitHub too.
+func githubRepositoriesOf(reviewApp kubetempurav1.ReviewApp, host string) []string {
+	var ret []string
+	if reviewApp.Spec.GithubRepository != "" {
+		ret = append(ret, reviewApp.Spec.GithubRepository)
+	}
+	for _, repository := range reviewApp.Spec.Repositories {
+		if h := repositoryHost(repository); h == "" || h == host {
+			ret = append(ret, repository)
+		}
+	}
+	return ret
+}
+
+// githubHost returns the host of the repositories of the GitHub REST API. E.g. github.com for https://api.github.com/
+func githubHost(apiURL string) string {
+	u, err := url.Parse(apiURL)
+	if err != nil {
+		return ""
+	}
+	host := strings.ToLower(u.Host)
+	if host == "api.github.com" {
+		return "github.com"
+	}
+	return host
+}
+
+// resyncRepository handles each open pull request as if it's synchronized, and deletes the PRs of the closed ones.
+// host and fullName are of the repository. E.g. github.com and mercari/kubetempura
+func (r *Resyncer) resyncRepository(ctx context.Context, host string, fullName string, reviewApps []kubetempurav1.ReviewApp) error {
+	// A PR created after the list was made may be of a pull request which was just opened.
+	listed := time.Now()
+	pullRequests, err := r.GitHub.ListOpenPullRequests(ctx, fullName)
+	if err != nil {
+		return err
+	}
+	p := &githubProvider{gh: r.GitHub}
+	open := map[string]bool{}
+	for _, prp := range pullRequests {
+		open[strconv.FormatInt(prp.Number, 10)] = true
+		prp.Action = "synchronize"
+		prp.Repository.HTMLURL = prp.PullRequest.Base.Repo.HTMLURL
+		if prp.Repository.HTMLURL == "" {
+			prp.Repository.HTMLURL = "https://" + repositoryID(host, fullName)
+		}
+		prp.Repository.FullName = fullName
+		e, err := newGitHubEvent(prp)
+		if err != nil {
+			return err
+		}
+		e.current = true
+		if err := handlePullRequest(ctx, p, e, "", r.Client); err != nil {
+			log.Error(err, "Failed to resync the pull request", "repository", fullName, "number", prp.Number)
+		}
+	}
+	id := repositoryID(host, fullName)
+	for _, reviewApp := range reviewApps {
+		var prs kubetempurav1.PRList
+		if err := r.Client.List(ctx, &prs, client.InNamespace(reviewApp.Namespace)); err != nil {
+			return err
+		}
+		for i, pr := range prs.Items {
+			if !isPROf(pr, reviewApp, id, pr.Spec.PRNumber) || open[pr.Spec.PRNumber] || !pr.CreationTimestamp.Time.Before(listed) {
+				continue
+			}
+			// A PR created before the repository was recorded is of this repository only when the ReviewApp has no other.
+			if pr.Spec.Repository == "" && hasManyRepositories(reviewApp) {
+				continue
+			}
+			log.Info("Deleting the PR of a closed pull request", "pr", pr.Name)
+			if err := r.Client.Delete(ctx, &prs.Items[i]); client.IgnoreNotFound(err) != nil {
+				log.Error(err, "Failed to delete the PR", "pr", pr.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// repositoryFullName returns the full name of a repository in lower case. E.g. mercari/kubetempura for https://github.com/mercari/kubetempura
+func repositoryFullName(repository string) (string, error) {
+	_, name := parseRepository(repository)
+	if strings.Count(name, "/") != 1 {
+		return "", fmt.Errorf("invalid repository URL: %s", repository)
+	}
+	return name, nil
+}
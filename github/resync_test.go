@@ -0,0 +1,94 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	kubetempurav1 "github.com/mercari/kubetempura/api/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestResync(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("state") != "open" {
+			http.NotFound(w, r)
+			return
+		}
+		switch r.URL.Path {
+		case "/repos/mercari/kubetempura/pulls":
+			_ = json.NewEncoder(w).Encode([]map[string]interface{}{
+				{"number": 1, "head": map[string]interface{}{"sha": "new"}},
+				{"number": 2, "head": map[string]interface{}{"sha": "opened"}},
+			})
+		case "/repos/mercari/admin/pulls":
+			_ = json.NewEncoder(w).Encode([]map[string]interface{}{})
+		case "/repos/mercari/api/pulls":
+			_ = json.NewEncoder(w).Encode([]map[string]interface{}{
+				{"number": 5, "head": map[string]interface{}{"sha": "api"}},
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	web := &kubetempurav1.ReviewApp{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+		Spec:       kubetempurav1.ReviewAppSpec{GithubRepository: "https://github.com/mercari/kubetempura"},
+	}
+	// The repositories are resynced too, except the ones on another host.
+	api := &kubetempurav1.ReviewApp{
+		ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "default"},
+		Spec:       kubetempurav1.ReviewAppSpec{Repositories: []string{"mercari/api", "mercari/admin", "gitlab.com/mercari/web"}},
+	}
+	stale := generatePRStruct(*web, pullRequest{number: "1", headSHA: "old"})
+	closed := generatePRStruct(*web, pullRequest{number: "3", headSHA: "closed"})
+	gitlab := generatePRStruct(*api, pullRequest{number: "7", headSHA: "gitlab", repository: "mercari/web", host: "gitlab.com"})
+	// The repository of a legacy PR of a ReviewApp with many repositories is unknown, so it's not deleted.
+	legacy := generatePRStruct(*api, pullRequest{number: "9", headSHA: "legacy"})
+	c := newFakeClient(t, web, api, &stale, &closed, &gitlab, &legacy)
+
+	r := &Resyncer{Client: c, GitHub: NewClient(server.URL, "")}
+	r.resync(context.Background())
+
+	var prs kubetempurav1.PRList
+	if err := c.List(context.Background(), &prs); err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]string{}
+	for _, pr := range prs.Items {
+		got[pr.Spec.ParentReviewApp+"#"+pr.Spec.PRNumber] = pr.Spec.HeadCommitRef
+	}
+	want := map[string]string{"web#1": "new", "web#2": "opened", "api#5": "api", "api#7": "gitlab", "api#9": "legacy"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("PRs = %v, want %v", got, want)
+	}
+}
+
+func TestRepositoryFullName(t *testing.T) {
+	tests := []struct {
+		repository string
+		want       string
+		wantErr    bool
+	}{
+		{repository: "https://github.com/mercari/kubetempura", want: "mercari/kubetempura"},
+		{repository: "https://github.com/mercari/kubetempura/", want: "mercari/kubetempura"},
+		{repository: "https://ghe.example.com/mercari/kubetempura.git", want: "mercari/kubetempura"},
+		{repository: "git@github.com:Mercari/KubeTempura.git", want: "mercari/kubetempura"},
+		{repository: "mercari/kubetempura", want: "mercari/kubetempura"},
+		{repository: "https://github.com/mercari", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := repositoryFullName(tt.repository)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("repositoryFullName(%v) error = %v, wantErr %v", tt.repository, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Fatalf("repositoryFullName(%v) = %v, want %v", tt.repository, got, tt.want)
+		}
+	}
+}
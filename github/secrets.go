@@ -0,0 +1,137 @@
+package github
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"net/http"
+	"strings"
+
+	kubetempurav1 "github.com/mercari/kubetempura/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var (
+	// errNoNamespaceSecrets means no ReviewApps in the namespace refer to a Secret, so the namespace has no webhook endpoint.
+	errNoNamespaceSecrets = errors.New("no ReviewApps in the namespace refer to a webhook secret")
+	errMissingSignature   = errors.New("missing X-Hub-Signature-256 or X-Hub-Signature Header")
+	errInvalidSignature   = errors.New("HMAC verification failed")
+)
+
+// webhookSecrets is the source of the secrets accepted for the webhooks.
+type webhookSecrets struct {
+	// client reads the ReviewApps from the cache of the manager.
+	client client.Reader
+	// secretReader reads the Secrets from the API server on each webhook, so a change of a Secret takes effect without a restart.
+	// The client reads them when it's nil.
+	secretReader client.Reader
+	// ref is the Secret which has the secrets. Each value of it is accepted, so a new secret can be added before the old one is removed.
+	ref types.NamespacedName
+	// static is the secret given by the flag.
+	static string
+}
+
+func (s *webhookSecrets) secrets() client.Reader {
+	if s.secretReader != nil {
+		return s.secretReader
+	}
+	return s.client
+}
+
+// get returns the accepted secrets. Nothing means the signatures are not verified.
+func (s *webhookSecrets) get(ctx context.Context) ([][]byte, error) {
+	var ret [][]byte
+	if s.static != "" {
+		ret = append(ret, []byte(s.static))
+	}
+	if s.ref.Name == "" {
+		return ret, nil
+	}
+	var secret corev1.Secret
+	if err := s.secrets().Get(ctx, s.ref, &secret); err != nil {
+		return nil, err
+	}
+	for _, v := range secret.Data {
+		if len(v) != 0 {
+			ret = append(ret, v)
+		}
+	}
+	if len(ret) == 0 {
+		// Don't accept any webhooks rather than the unsigned ones.
+		return nil, errors.New("the Secret of the webhooks has no secrets")
+	}
+	return ret, nil
+}
+
+// getForNamespace returns the secrets of the Secrets referred from the ReviewApps in the namespace.
+// The secrets of the shared endpoint are not accepted, so a namespace can't receive the events signed by another team.
+func (s *webhookSecrets) getForNamespace(ctx context.Context, namespace string) ([][]byte, error) {
+	var reviewApps kubetempurav1.ReviewAppList
+	if err := s.client.List(ctx, &reviewApps, client.InNamespace(namespace)); err != nil {
+		return nil, err
+	}
+	var ret [][]byte
+	seen := map[string]bool{}
+	for _, reviewApp := range reviewApps.Items {
+		ref := reviewApp.Spec.WebhookSecretRef
+		if ref == nil || ref.Name == "" || seen[ref.Name] {
+			continue
+		}
+		seen[ref.Name] = true
+		var secret corev1.Secret
+		if err := s.secrets().Get(ctx, types.NamespacedName{Namespace: namespace, Name: ref.Name}, &secret); err != nil {
+			// The other Secrets may have the secret.
+			log.Error(err, "Failed to get the webhook secret", "namespace", namespace, "name", ref.Name)
+			continue
+		}
+		for _, v := range secret.Data {
+			if len(v) != 0 {
+				ret = append(ret, v)
+			}
+		}
+	}
+	if len(ret) == 0 {
+		return nil, errNoNamespaceSecrets
+	}
+	return ret, nil
+}
+
+// verifySignature returns nil when the payload is signed with one of the secrets.
+// X-Hub-Signature-256 is preferred. X-Hub-Signature (SHA-1) is for GitHub Enterprise Server which doesn't send the former.
+func verifySignature(header http.Header, payload []byte, secrets [][]byte) error {
+	if len(secrets) == 0 {
+		return nil
+	}
+	var newHash func() hash.Hash
+	var signature string
+	if s := header.Get("X-Hub-Signature-256"); s != "" {
+		newHash, signature = sha256.New, strings.TrimPrefix(s, "sha256=")
+	} else if s := header.Get("X-Hub-Signature"); s != "" {
+		newHash, signature = sha1.New, strings.TrimPrefix(s, "sha1=")
+	} else {
+		return errMissingSignature
+	}
+	return verifyHMAC(newHash, signature, payload, secrets)
+}
+
+// verifyHMAC returns nil when the hex signature is the HMAC of the payload with one of the secrets.
+func verifyHMAC(newHash func() hash.Hash, signature string, payload []byte, secrets [][]byte) error {
+	got, err := hex.DecodeString(signature)
+	if err != nil {
+		return errInvalidSignature
+	}
+	for _, secret := range secrets {
+		mac := hmac.New(newHash, secret)
+		_, _ = mac.Write(payload)
+		if hmac.Equal(got, mac.Sum(nil)) {
+			return nil
+		}
+	}
+	return errInvalidSignature
+}
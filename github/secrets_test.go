@@ -0,0 +1,176 @@
+package github
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"testing"
+
+	kubetempurav1 "github.com/mercari/kubetempura/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func sign256(secret string, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write([]byte(payload))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifySignature(t *testing.T) {
+	payload := `{"action": "opened"}`
+	secrets := [][]byte{[]byte("old"), []byte("new")}
+	sha1Header := newWebhookRequest(t, "pull_request", "1", payload, "new").Header.Get("X-Hub-Signature")
+
+	tests := []struct {
+		name    string
+		header  http.Header
+		secrets [][]byte
+		wantErr error
+	}{
+		{
+			name:    "no secrets",
+			header:  http.Header{},
+			wantErr: nil,
+		},
+		{
+			name:    "SHA-256 with the old secret",
+			header:  http.Header{"X-Hub-Signature-256": {sign256("old", payload)}},
+			secrets: secrets,
+		},
+		{
+			name:    "SHA-256 with the new secret",
+			header:  http.Header{"X-Hub-Signature-256": {sign256("new", payload)}},
+			secrets: secrets,
+		},
+		{
+			name:    "SHA-1",
+			header:  http.Header{"X-Hub-Signature": {sha1Header}},
+			secrets: secrets,
+		},
+		{
+			name:    "SHA-256 is preferred",
+			header:  http.Header{"X-Hub-Signature-256": {sign256("wrong", payload)}, "X-Hub-Signature": {sha1Header}},
+			secrets: secrets,
+			wantErr: errInvalidSignature,
+		},
+		{
+			name:    "unknown secret",
+			header:  http.Header{"X-Hub-Signature-256": {sign256("wrong", payload)}},
+			secrets: secrets,
+			wantErr: errInvalidSignature,
+		},
+		{
+			name:    "not hex",
+			header:  http.Header{"X-Hub-Signature-256": {"sha256=xyz"}},
+			secrets: secrets,
+			wantErr: errInvalidSignature,
+		},
+		{
+			name:    "missing signature",
+			header:  http.Header{},
+			secrets: secrets,
+			wantErr: errMissingSignature,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := verifySignature(tt.header, []byte(payload), tt.secrets); err != tt.wantErr {
+				t.Fatalf("verifySignature() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWebhookSecrets(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "github-webhooks", Namespace: "kubetempura-system"},
+		Data:       map[string][]byte{"secret": []byte("old")},
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(secret).Build()
+	s := &webhookSecrets{client: c, ref: types.NamespacedName{Namespace: "kubetempura-system", Name: "github-webhooks"}, static: "flag"}
+
+	got, err := s.get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || string(got[0]) != "flag" || string(got[1]) != "old" {
+		t.Fatalf("get() = %q, want flag and old", got)
+	}
+
+	// Rotate the secret.
+	secret.Data["next"] = []byte("new")
+	if err := c.Update(context.Background(), secret); err != nil {
+		t.Fatal(err)
+	}
+	got, err = s.get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 {
+		t.Fatalf("get() = %q, want the new secret too", got)
+	}
+
+	s.static = ""
+	secret.Data = map[string][]byte{}
+	if err := c.Update(context.Background(), secret); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.get(context.Background()); err == nil {
+		t.Fatal("get() must fail without secrets")
+	}
+
+	s.ref.Name = "not-exists"
+	if _, err := s.get(context.Background()); err == nil {
+		t.Fatal("get() must fail without the Secret")
+	}
+}
+
+func TestWebhookSecretsForNamespace(t *testing.T) {
+	c := newFakeClient(t,
+		&kubetempurav1.ReviewApp{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "team-a"},
+			Spec:       kubetempurav1.ReviewAppSpec{WebhookSecretRef: &corev1.LocalObjectReference{Name: "webhook"}},
+		},
+		&kubetempurav1.ReviewApp{
+			ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "team-a"},
+			Spec:       kubetempurav1.ReviewAppSpec{WebhookSecretRef: &corev1.LocalObjectReference{Name: "not-exists"}},
+		},
+		&kubetempurav1.ReviewApp{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "team-b"},
+		},
+	)
+	// The Secrets are read from the API server rather than the cache.
+	apiReader := newFakeClient(t,
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "webhook", Namespace: "team-a"},
+			Data:       map[string][]byte{"secret": []byte("team-a-secret")},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "webhook", Namespace: "team-b"},
+			Data:       map[string][]byte{"secret": []byte("team-b-secret")},
+		},
+	)
+	s := &webhookSecrets{client: c, secretReader: apiReader, static: "shared"}
+
+	got, err := s.getForNamespace(context.Background(), "team-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || string(got[0]) != "team-a-secret" {
+		t.Fatalf("getForNamespace() = %q, want only the secret of team-a", got)
+	}
+	// The Secret of team-b isn't referred from its ReviewApps.
+	if _, err := s.getForNamespace(context.Background(), "team-b"); err != errNoNamespaceSecrets {
+		t.Fatalf("getForNamespace() = %v, want %v", err, errNoNamespaceSecrets)
+	}
+}
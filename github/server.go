@@ -0,0 +1,155 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// shutdownTimeout is the time to wait for the requests in flight on shutdown. It's shorter than the graceful shutdown timeout of the manager (30s).
+const shutdownTimeout = 20 * time.Second
+
+// WebhookOptions configures the server of the webhooks and the processing of them.
+type WebhookOptions struct {
+	// SecretRef is the Secret which has the secrets of the webhooks. It's optional.
+	SecretRef types.NamespacedName
+	// APIReader reads the Secrets of the webhooks without the cache, which would watch all the Secrets in the cluster.
+	// The client of the server reads them when it's nil. E.g. in tests
+	APIReader client.Reader
+
+	// BindAddress is the address the server listens on. E.g. ":3000"
+	BindAddress string
+	// CertFile and KeyFile are the paths of the TLS certificate and key. The server serves HTTP when they are empty.
+	CertFile string
+	KeyFile  string
+	// ReadTimeout and WriteTimeout are the timeouts of a request. 0 means no timeout.
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+
+	// Workers is the number of the events processed at the same time.
+	Workers int
+	// QueueSize is the number of the events waiting to be processed. A webhook is rejected with 503 when the queue is full.
+	QueueSize int
+	// Timeout is the time limit of each try of an event.
+	Timeout time.Duration
+
+	// Providers are the names of the Git hosting services which the webhooks are accepted from. E.g. github
+	Providers []string
+	// ProviderSecrets are the secrets of the shared endpoints of the providers other than GitHub by name. E.g. gitlab
+	// The secrets of GitHub aren't accepted by them. E.g. GitLab sends the secret token as it is, so it must not be the HMAC key of GitHub.
+	ProviderSecrets map[string]ProviderSecret
+	// ReportStatus enables the commit statuses of the review apps on GitHub.
+	ReportStatus bool
+}
+
+// ProviderSecret is the secret of the shared endpoint of a provider.
+type ProviderSecret struct {
+	// Secret is the secret given by the flag. It's optional.
+	Secret string
+	// SecretRef is the Secret which has the secrets. Each value of it is accepted. It's optional.
+	SecretRef types.NamespacedName
+}
+
+// WebhookServer serves the webhooks from the providers. It's added to the manager, so it runs in all the replicas.
+type WebhookServer struct {
+	opts     WebhookOptions
+	handlers []*webhookHandler
+	// serving is 1 while the server is listening.
+	serving int32
+}
+
+// NewWebhookServer returns a server which accepts the webhooks of GitHub signed with githubWebHookSecret or one of the values of the Secret of opts.SecretRef.
+// The other providers accept the secrets of opts.ProviderSecrets.
+func NewWebhookServer(c client.Client, githubWebHookSecret string, gh *Client, opts WebhookOptions) (*WebhookServer, error) {
+	if (opts.CertFile == "") != (opts.KeyFile == "") {
+		return nil, errors.New("both of the TLS certificate and key are required")
+	}
+	if len(opts.Providers) == 0 {
+		return nil, errors.New("no providers of the webhooks")
+	}
+	s := &WebhookServer{opts: opts}
+	for _, name := range opts.Providers {
+		p, err := newProvider(name, gh, opts)
+		if err != nil {
+			return nil, err
+		}
+		secrets := &webhookSecrets{client: c, secretReader: opts.APIReader, ref: opts.SecretRef, static: githubWebHookSecret}
+		if name != providerGitHub {
+			secret := opts.ProviderSecrets[name]
+			secrets = &webhookSecrets{client: c, secretReader: opts.APIReader, ref: secret.SecretRef, static: secret.Secret}
+		}
+		s.handlers = append(s.handlers, newWebhookHandler(p, c, secrets, opts))
+	}
+	return s, nil
+}
+
+// Start serves the webhooks until the context is done, and then waits for the requests in flight.
+// The events accepted but not processed yet are dropped. The resync recovers them.
+func (s *WebhookServer) Start(ctx context.Context) error {
+	serveMux := http.NewServeMux()
+	for _, h := range s.handlers {
+		serveMux.Handle(h.path, h)
+		// The endpoints of the namespaces. E.g. /webhooks/my-team
+		serveMux.Handle(h.path+"/", h)
+	}
+	serveMux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		_, err := w.Write([]byte("I'm KubeTempura."))
+		if err != nil {
+			log.Error(err, "Failed to return the response")
+		}
+	})
+	server := &http.Server{
+		Handler:      serveMux,
+		ReadTimeout:  s.opts.ReadTimeout,
+		WriteTimeout: s.opts.WriteTimeout,
+	}
+
+	listener, err := net.Listen("tcp", s.opts.BindAddress)
+	if err != nil {
+		return err
+	}
+	for _, h := range s.handlers {
+		go h.events.run(ctx)
+	}
+	serveErr := make(chan error, 1)
+	go func() {
+		if s.opts.CertFile != "" {
+			serveErr <- server.ServeTLS(listener, s.opts.CertFile, s.opts.KeyFile)
+		} else {
+			serveErr <- server.Serve(listener)
+		}
+	}()
+	atomic.StoreInt32(&s.serving, 1)
+	defer atomic.StoreInt32(&s.serving, 0)
+	log.Info("Github Webhooks started", "address", listener.Addr().String())
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+	log.Info("Shutting down the Github Webhooks")
+	atomic.StoreInt32(&s.serving, 0)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	return server.Shutdown(shutdownCtx)
+}
+
+// NeedLeaderElection returns false, because a webhook is delivered to any of the replicas.
+func (s *WebhookServer) NeedLeaderElection() bool {
+	return false
+}
+
+// ReadyCheck fails unless the server is listening. It's a healthz.Checker.
+func (s *WebhookServer) ReadyCheck(_ *http.Request) error {
+	if atomic.LoadInt32(&s.serving) == 0 {
+		return errors.New("the webhook server is not serving")
+	}
+	return nil
+}
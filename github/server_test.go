@@ -0,0 +1,98 @@
+package github
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestWebhookServer(t *testing.T) {
+	// Find a free port.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	s, err := NewWebhookServer(newFakeClient(t), testSecret, NewClient("http://localhost", ""), WebhookOptions{
+		BindAddress: addr,
+		Workers:     1,
+		QueueSize:   1,
+		Timeout:     time.Second,
+		Providers:   ProviderNames(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.ReadyCheck(nil) == nil {
+		t.Fatal("ReadyCheck() must fail before the server starts")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error, 1)
+	go func() { stopped <- s.Start(ctx) }()
+	for i := 0; s.ReadyCheck(nil) != nil; i++ {
+		if i == 100 {
+			t.Fatal("the server must be ready")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	res, err := http.Get("http://" + addr + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if string(body) != "I'm KubeTempura." {
+		t.Fatalf("body = %q", body)
+	}
+
+	cancel()
+	select {
+	case err := <-stopped:
+		if err != nil {
+			t.Fatalf("Start() = %v, want nil", err)
+		}
+	case <-time.After(shutdownTimeout):
+		t.Fatal("the server must shut down")
+	}
+	if s.ReadyCheck(nil) == nil {
+		t.Fatal("ReadyCheck() must fail after the server stops")
+	}
+}
+
+func TestNewWebhookServer(t *testing.T) {
+	if _, err := NewWebhookServer(newFakeClient(t), testSecret, nil, WebhookOptions{CertFile: "tls.crt"}); err == nil {
+		t.Fatal("NewWebhookServer() must require the TLS key with the certificate")
+	}
+	if _, err := NewWebhookServer(newFakeClient(t), testSecret, nil, WebhookOptions{Providers: []string{"bitbucket"}}); err == nil {
+		t.Fatal("NewWebhookServer() must reject an unknown provider")
+	}
+}
+
+func TestNewWebhookServerProviderSecrets(t *testing.T) {
+	s, err := NewWebhookServer(newFakeClient(t), testSecret, NewClient("http://localhost", ""), WebhookOptions{
+		Providers:       []string{providerGitHub, providerGitLab, providerGitea},
+		ProviderSecrets: map[string]ProviderSecret{providerGitLab: {Secret: "gitlab"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Each provider accepts only its own secrets.
+	want := map[string]string{providerGitHub: testSecret, providerGitLab: "gitlab", providerGitea: ""}
+	for _, h := range s.handlers {
+		secrets, err := h.secrets.get(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(bytes.Join(secrets, []byte(","))); got != want[h.provider.name()] {
+			t.Errorf("secrets of %s = %q, want %q", h.provider.name(), got, want[h.provider.name()])
+		}
+	}
+}
@@ -1,103 +1,324 @@
 package github
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
 	"net/http"
-	"strconv"
+	"strings"
 
-	"github.com/go-playground/webhooks/v6/github"
 	kubetempurav1 "github.com/mercari/kubetempura/api/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/util/retry"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 const (
 	path = "/webhooks"
+
+	// maxPayloadSize is the limit of a payload. GitHub doesn't send a payload larger than 25 MB.
+	maxPayloadSize = 25 << 20
 )
 
 var (
 	log = ctrl.Log.WithName("github")
+
+	// errStaleEvent means the PR was already updated by a newer event.
+	errStaleEvent = errors.New("the PR was updated by a newer event")
+	// errUnknownAuthor means the provider doesn't tell the author of the pull request, so the author filters can't be applied.
+	errUnknownAuthor = errors.New("the author of the pull request is unknown, so the authors and the allowlist of the forkPolicy aren't supported")
 )
 
-func Webhooks(c client.Client, githubWebHookSecret string) {
-	hook, err := github.New(github.Options.Secret(githubWebHookSecret))
+// webhookHandler accepts the webhooks from a provider, and processes them in the queue.
+// The status code tells the provider whether the delivery was accepted.
+type webhookHandler struct {
+	// path is the path of the shared endpoint. The endpoint of a namespace is under it. E.g. /webhooks/my-team
+	path       string
+	provider   provider
+	client     client.Client
+	secrets    *webhookSecrets
+	deliveries *deliveryCache
+	events     *eventQueue
+}
+
+func newWebhookHandler(provider provider, c client.Client, secrets *webhookSecrets, opts WebhookOptions) *webhookHandler {
+	h := &webhookHandler{
+		path:       provider.path(),
+		provider:   provider,
+		client:     c,
+		secrets:    secrets,
+		deliveries: newDeliveryCache(deliveryCacheSize),
+	}
+	h.events = newEventQueue(provider.name()+"-webhooks", opts.QueueSize, opts.Workers, opts.Timeout, h.handleEvent)
+	// The delivery can be redelivered after all the retries failed.
+	h.events.giveUp = func(e *event) { h.deliveries.remove(e.delivery) }
+	return h
+}
+
+func (h *webhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	log.Info("request:", "request", r.RequestURI, "provider", h.provider.name())
+	if r.Method != http.MethodPost {
+		http.Error(w, "invalid HTTP Method", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxPayloadSize))
 	if err != nil {
-		log.Error(err, "Failed to initialize the GitHub library")
+		http.Error(w, "Failed to read the payload.", http.StatusRequestEntityTooLarge)
+		return
+	}
+	// The shared endpoint has an empty namespace.
+	namespace := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, h.path), "/")
+	if namespace != "" && len(validation.IsDNS1123Label(namespace)) != 0 {
+		http.NotFound(w, r)
+		return
+	}
+	var secrets [][]byte
+	if namespace == "" {
+		secrets, err = h.secrets.get(r.Context())
+	} else {
+		secrets, err = h.secrets.getForNamespace(r.Context(), namespace)
+	}
+	if err == errNoNamespaceSecrets {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Error(err, "Failed to get the secrets of the webhooks", "namespace", namespace)
+		http.Error(w, "Failed to verify the signature.", http.StatusInternalServerError)
+		return
+	}
+	if err := h.provider.verify(r.Header, body, secrets); err != nil {
+		log.Error(err, "Failed to verify the request.", "provider", h.provider.name())
+		http.Error(w, err.Error(), http.StatusUnauthorized)
 		return
 	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	pullRequestEvent, err := h.provider.parse(r)
+	if err == errIgnoredEvent {
+		writeResponse(w, http.StatusOK, "Ignored the event.")
+		return
+	}
+	if err == errPing {
+		log.Info("Received a ping", "provider", h.provider.name())
+		writeResponse(w, http.StatusOK, "pong")
+		return
+	}
+	if err != nil {
+		log.Error(err, "Failed to parse the request.", "provider", h.provider.name())
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	delivery := h.provider.deliveryID(r.Header)
+	if !h.deliveries.checkAndAdd(delivery) {
+		log.Info("Ignored a redelivery", "delivery", delivery)
+		writeResponse(w, http.StatusOK, "Already accepted the delivery.")
+		return
+	}
+	if !h.events.add(&event{delivery: delivery, namespace: namespace, pullRequest: pullRequestEvent}) {
+		// The redelivery is accepted later.
+		h.deliveries.remove(delivery)
+		log.Info("Rejected the event because the queue is full", "delivery", delivery)
+		http.Error(w, "Too many events. Redeliver it later.", http.StatusServiceUnavailable)
+		return
+	}
+	writeResponse(w, http.StatusAccepted, "Accepted")
+}
 
-	log.Info("Github Webhooks started")
+func (h *webhookHandler) handleEvent(ctx context.Context, e *event) error {
+	e.pullRequest.sharedEndpoint = e.namespace == ""
+	if e.pullRequest.command != nil {
+		return handleCommand(ctx, h.provider, e.pullRequest, e.namespace, h.client)
+	}
+	if e.pullRequest.check != nil {
+		return handleCheck(ctx, h.provider, e.pullRequest, e.namespace, h.client)
+	}
+	return handlePullRequest(ctx, h.provider, e.pullRequest, e.namespace, h.client)
+}
 
-	serveMux := http.NewServeMux()
-	serveMux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
-		log.Info("request:", "request", r.RequestURI)
-		payload, err := hook.Parse(r, github.PullRequestEvent)
+func writeResponse(w http.ResponseWriter, code int, body string) {
+	w.WriteHeader(code)
+	_, err := w.Write([]byte(body))
+	if err != nil {
+		log.Error(err, "Failed to return the response")
+	}
+}
+
+// handlePullRequest creates, updates or deletes the PRs of the ReviewApps of the repository for the event. An error means some of them were not handled.
+// Only the ReviewApps in the namespace handle the event. An empty namespace means all namespaces.
+func handlePullRequest(ctx context.Context, p provider, e *pullRequestEvent, namespace string, c client.Client) error {
+	reviewApps, err := findReviewAppsOfEvent(ctx, c, p, e, namespace)
+	if err != nil {
+		return err
+	}
+	if len(reviewApps) == 0 {
+		return nil
+	}
+	pr := e.pullRequest
+	pr.current = e.current
+	if e.closed {
+		return prClosed(ctx, reviewApps, pr, c)
+	}
+	if needsChangedFiles(reviewApps) {
+		pr.changedFiles, err = p.listFiles(ctx, e)
 		if err != nil {
-			if err == github.ErrEventNotFound {
-				// ok event wasn't one of the ones asked to be parsed
-			}
-			log.Error(err, "Failed to parse the request from GitHub.")
-			return
+			return fmt.Errorf("failed to list the changed files of the PR: %w", err)
 		}
-		switch payload.(type) {
-		case github.PullRequestPayload:
-			pullRequest := payload.(github.PullRequestPayload)
-			handlePREvent(pullRequest, c)
+	}
+	var errs []error
+	var deploys, undeploys, waits []kubetempurav1.ReviewApp
+	for _, reviewApp := range reviewApps {
+		if pr.author == "" && hasAuthorFilter(reviewApp, pr) {
+			// E.g. the payload of GitLab doesn't have the login of the author. The filters would deny or allow every pull request.
+			log.Error(errUnknownAuthor, "Ignored the event for the ReviewApp with the author filters", "provider", p.name(), "reviewApp", reviewApp.Name, "prNumber", pr.number)
+			continue
 		}
-		_, err = w.Write([]byte("OK"))
+		allowed, err := isAllowed(ctx, reviewApp, pr, p.teamMembers())
 		if err != nil {
-			log.Error(err, "Failed to return the response")
+			errs = append(errs, fmt.Errorf("failed to evaluate the author of the PR for %s: %w", reviewApp.Name, err))
+			continue
 		}
-	})
-	serveMux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		_, err := w.Write([]byte("I'm KubeTempura."))
+		if allowed {
+			waiting, err := waitingForApproval(ctx, reviewApp, pr, c)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to find the PR of %s: %w", reviewApp.Name, err))
+				continue
+			}
+			if waiting {
+				// The PR of the approved commit is kept as it is.
+				log.Info("Waiting for the approval label of the new commit of the fork", "reviewApp", reviewApp.Name, "prNumber", pr.number, "label", reviewApp.Spec.ForkPolicy.ApprovalLabel)
+				continue
+			}
+		}
+		deploy := allowed && shouldDeploy(reviewApp, pr)
+		if !deploy {
+			// It was deployed by /tempura deploy regardless of the filters.
+			pinned, err := isPinned(ctx, reviewApp, pr, c)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to find the PR of %s: %w", reviewApp.Name, err))
+				continue
+			}
+			if pinned && !allowed {
+				// The commits and the description changed by a fork or a denied author after /tempura deploy aren't deployed until it's run again.
+				// The PR isn't updated at all, because the description has the environment variables and the variables.
+				log.Info("Kept the PR deployed by the command, because the author or the fork isn't allowed", "reviewApp", reviewApp.Name, "prNumber", pr.number)
+				continue
+			}
+			deploy = pinned
+		}
+		if !deploy {
+			undeploys = append(undeploys, reviewApp)
+			continue
+		}
+		passed, err := checkPassed(ctx, p, e, reviewApp)
 		if err != nil {
-			log.Error(err, "Failed to return the response")
+			errs = append(errs, fmt.Errorf("failed to read the check %s for %s: %w", reviewApp.Spec.RequiredCheck, reviewApp.Name, err))
+			continue
 		}
-	})
-
-	err = http.ListenAndServe(":3000", serveMux)
+		if passed {
+			deploys = append(deploys, reviewApp)
+		} else {
+			log.Info("Waiting for the required check", "reviewApp", reviewApp.Name, "prNumber", pr.number, "check", reviewApp.Spec.RequiredCheck)
+			waits = append(waits, reviewApp)
+		}
+	}
+	closedNow, err := isClosedNow(ctx, p, e, deploys, c)
 	if err != nil {
-		log.Error(err, "Failed to listen and serve the github webhook.")
-		return
+		// The event is applied as it is. The resync deletes the PRs if the pull request is closed.
+		log.Error(err, "Failed to read the state of the pull request", "provider", p.name(), "prNumber", pr.number)
+	} else if closedNow {
+		log.Info("Ignored an event of a closed pull request", "provider", p.name(), "prNumber", pr.number)
+		deploys = nil
+	}
+	// E.g. the required label is removed, or the base branch is changed.
+	errs = append(errs, prClosed(ctx, undeploys, pr, c))
+	errs = append(errs, prWaiting(ctx, waits, pr, c))
+	if err := prUpdated(ctx, deploys, pr, c); err != nil {
+		errs = append(errs, err)
+	} else if r, ok := p.(reporter); ok {
+		// The PRs are already updated, so a failure of the report doesn't retry the event.
+		for _, reviewApp := range deploys {
+			if err := r.report(ctx, e, reviewApp); err != nil {
+				log.Error(err, "Failed to report the review app", "provider", p.name(), "reviewApp", reviewApp.Name, "prNumber", pr.number)
+			}
+		}
 	}
+	return utilerrors.NewAggregate(errs)
 }
 
-func handlePREvent(prp github.PullRequestPayload, c client.Client) {
-	if !(prp.Action == "opened" ||
-		prp.Action == "reopened" ||
-		prp.Action == "synchronize" ||
-		prp.Action == "closed") {
-		return
+// isClosedNow returns true when the pull request of a delayed event was already closed, so the event doesn't create the PRs again.
+// The PRs of the closed pull request are already deleted, so the times of the events can't be compared.
+// It reads the pull request only when a PR is created. A provider which can't read the pull requests doesn't check it.
+func isClosedNow(ctx context.Context, p provider, e *pullRequestEvent, reviewApps []kubetempurav1.ReviewApp, c client.Client) (bool, error) {
+	chk, ok := p.(checker)
+	if !ok || e.current {
+		return false, nil
 	}
-	reviewApps, err := getReviewApps(c)
-	if err != nil {
-		log.Error(err, "Failed to get ReviewApps")
-		return
+	creates := false
+	for _, reviewApp := range reviewApps {
+		prs, err := findPRs(ctx, reviewApp, e.pullRequest.repositoryID(), e.pullRequest.number, c)
+		if err != nil {
+			return false, err
+		}
+		if len(prs) == 0 {
+			creates = true
+			break
+		}
 	}
-	reviewApps = findReviewAppsByRepository(reviewApps, prp.Repository.HTMLURL)
-	if len(reviewApps) == 0 {
-		return
+	if !creates {
+		return false, nil
 	}
-	prNumber := strconv.FormatInt(prp.Number, 10)
-	if prp.Action == "closed" {
-		prClosed(reviewApps, prNumber, c)
-		return
+	current, err := chk.getPullRequestEvent(ctx, e)
+	if err != nil {
+		return false, err
+	}
+	return current.closed, nil
+}
+
+func needsChangedFiles(reviewApps []kubetempurav1.ReviewApp) bool {
+	for _, reviewApp := range reviewApps {
+		if hasPathFilter(reviewApp) {
+			return true
+		}
 	}
-	prUpdated(reviewApps, prNumber, prp.PullRequest.Head.Sha, c)
+	return false
 }
 
-func getReviewApps(c client.Client) ([]kubetempurav1.ReviewApp, error) {
+func getReviewApps(ctx context.Context, c client.Client, namespace string) ([]kubetempurav1.ReviewApp, error) {
 	var reviewApps = kubetempurav1.ReviewAppList{}
-	err := c.List(context.Background(), &reviewApps)
+	err := c.List(ctx, &reviewApps, client.InNamespace(namespace))
 	return reviewApps.Items, err
 }
 
-func findReviewAppsByRepository(reviewApps []kubetempurav1.ReviewApp, repository string) []kubetempurav1.ReviewApp {
+// findReviewAppsOfEvent returns the ReviewApps in the namespace which handle the event of the repository.
+// The shared endpoint doesn't deliver the events to the ReviewApps with their own endpoints, because it has another secret.
+func findReviewAppsOfEvent(ctx context.Context, c client.Reader, p provider, e *pullRequestEvent, namespace string) ([]kubetempurav1.ReviewApp, error) {
+	reviewApps, err := getReviewAppsByRepository(ctx, c, namespace, e.repository)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ReviewApps: %w", err)
+	}
+	var ret []kubetempurav1.ReviewApp
+	for _, reviewApp := range findReviewAppsByRepository(reviewApps, p, e.repository) {
+		if e.sharedEndpoint && reviewApp.Spec.WebhookSecretRef != nil {
+			continue
+		}
+		ret = append(ret, reviewApp)
+	}
+	return ret, nil
+}
+
+func findReviewAppsByRepository(reviewApps []kubetempurav1.ReviewApp, p provider, repository string) []kubetempurav1.ReviewApp {
 	var ret []kubetempurav1.ReviewApp
 	for _, reviewApp := range reviewApps {
-		if reviewApp.Spec.GithubRepository == repository {
+		if matchAnyRepository(p.repositoriesOf(reviewApp), repository) {
 			ret = append(ret, reviewApp)
 			continue
 		}
@@ -105,50 +326,228 @@ func findReviewAppsByRepository(reviewApps []kubetempurav1.ReviewApp, repository
 	return ret
 }
 
-func prClosed(reviewApps []kubetempurav1.ReviewApp, prNumber string, c client.Client) {
+func prClosed(ctx context.Context, reviewApps []kubetempurav1.ReviewApp, pullRequest pullRequest, c client.Client) error {
+	var errs []error
 	for _, reviewApp := range reviewApps {
-		pr := generatePRStruct(reviewApp, prNumber, "")
-		err := c.Delete(context.Background(), &pr)
+		prs, err := findPRs(ctx, reviewApp, pullRequest.repositoryID(), pullRequest.number, c)
 		if err != nil {
-			log.Error(err, "Failed to delete the PR")
+			errs = append(errs, fmt.Errorf("failed to find the PR of %s: %w", reviewApp.Name, err))
+			continue
+		}
+		for i := range prs {
+			if isStale(prs[i], pullRequest) {
+				log.Info("Ignored an older event", "pr", prs[i].Name)
+				continue
+			}
+			err := c.Delete(ctx, &prs[i])
+			if client.IgnoreNotFound(err) != nil {
+				errs = append(errs, fmt.Errorf("failed to delete the PR %s: %w", prs[i].Name, err))
+			}
 		}
 	}
+	return utilerrors.NewAggregate(errs)
 }
 
-func prUpdated(reviewApps []kubetempurav1.ReviewApp, prNumber string, sha string, c client.Client) {
+func prUpdated(ctx context.Context, reviewApps []kubetempurav1.ReviewApp, pullRequest pullRequest, c client.Client) error {
+	var errs []error
 	for _, reviewApp := range reviewApps {
 		log.Info("PR updated" + reviewApp.Name)
-		pr := generatePRStruct(reviewApp, prNumber, sha)
-		rendered := *pr.DeepCopy()
-		_, err := ctrl.CreateOrUpdate(context.Background(), c, &pr, func() error {
-			pr.Spec = rendered.Spec
-			return ctrl.SetControllerReference(&reviewApp, &pr, c.Scheme())
-		})
+		err := updatePRWithRetry(ctx, reviewApp, pullRequest, c, nil)
+		if err == errStaleEvent {
+			log.Info("Ignored an older event", "reviewApp", reviewApp.Name, "prNumber", pullRequest.number)
+			continue
+		}
 		if err != nil {
-			log.Error(err, "Failed to create/update the PR")
+			errs = append(errs, fmt.Errorf("failed to create/update the PR of %s: %w", reviewApp.Name, err))
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// updatePRWithRetry calls updatePR again when another delivery created or updated the same PR at the same time.
+// The event times are compared again with the latest PR.
+func updatePRWithRetry(ctx context.Context, reviewApp kubetempurav1.ReviewApp, pullRequest pullRequest, c client.Client, edit func(spec *kubetempurav1.PRSpec)) error {
+	return retry.OnError(retry.DefaultRetry, func(err error) bool {
+		return apierrors.IsConflict(err) || apierrors.IsAlreadyExists(err)
+	}, func() error {
+		return updatePR(ctx, reviewApp, pullRequest, c, edit)
+	})
+}
+
+// updatePR creates or updates the PR of the ReviewApp for the pull request unless it was updated by a newer event.
+// edit changes the spec after it's rendered. It may be nil.
+func updatePR(ctx context.Context, reviewApp kubetempurav1.ReviewApp, pullRequest pullRequest, c client.Client, edit func(spec *kubetempurav1.PRSpec)) error {
+	pr := generatePRStruct(reviewApp, pullRequest)
+	prs, err := findPRs(ctx, reviewApp, pullRequest.repositoryID(), pullRequest.number, c)
+	if err != nil {
+		return err
+	}
+	if len(prs) != 0 {
+		// Keep the name of the existing PR. It may be named by an older version.
+		pr.Name = prs[0].Name
+	}
+	rendered := *pr.DeepCopy()
+	_, err = ctrl.CreateOrUpdate(ctx, c, &pr, func() error {
+		if isStale(pr, pullRequest) {
+			return errStaleEvent
+		}
+		existing := pr.Spec
+		pr.Spec = rendered.Spec
+		keepCommandFields(&pr.Spec, existing)
+		if edit != nil {
+			edit(&pr.Spec)
+		}
+		labels := pr.GetLabels()
+		if labels == nil {
+			labels = map[string]string{}
+		}
+		for k, v := range rendered.GetLabels() {
+			labels[k] = v
 		}
+		pr.SetLabels(labels)
+		return ctrl.SetControllerReference(&reviewApp, &pr, c.Scheme())
+	})
+	return err
+}
+
+// isStale returns true when the PR was updated by an event newer than the pull request.
+// The times have a precision of seconds and the deliveries are handled in parallel, so the order of the events in the same second is unknown.
+// Such an event with another commit is stale unless the pull request was read from the API. The resync deploys the head commit if it was newer.
+func isStale(pr kubetempurav1.PR, pullRequest pullRequest) bool {
+	if pr.Spec.LastEventTime == nil {
+		return false
+	}
+	last := pr.Spec.LastEventTime.Time
+	if pullRequest.updatedAt.Before(last) {
+		return true
+	}
+	return pullRequest.updatedAt.Equal(last) && pullRequest.headSHA != pr.Spec.HeadCommitRef && !pullRequest.current
+}
+
+// findPRs returns the PRs of the ReviewApp for the pull request. An empty repository matches the pull request of any repository.
+func findPRs(ctx context.Context, reviewApp kubetempurav1.ReviewApp, repository string, prNumber string, c client.Client) ([]kubetempurav1.PR, error) {
+	var prs = kubetempurav1.PRList{}
+	err := c.List(ctx, &prs, client.InNamespace(reviewApp.Namespace), client.MatchingLabels{
+		kubetempurav1.LabelReviewApp: labelValue(reviewApp.Name),
+		kubetempurav1.LabelPRNumber:  prNumber,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var ret []kubetempurav1.PR
+	for _, pr := range prs.Items {
+		if isPROf(pr, reviewApp, repository, prNumber) {
+			ret = append(ret, pr)
+		}
+	}
+	if len(ret) != 0 {
+		return ret, nil
+	}
+
+	// A PR created by an older version doesn't have the labels.
+	var pr = kubetempurav1.PR{}
+	err = c.Get(ctx, types.NamespacedName{Namespace: reviewApp.Namespace, Name: legacyPRName(reviewApp.Name, prNumber)}, &pr)
+	if err != nil {
+		return nil, client.IgnoreNotFound(err)
+	}
+	if isPROf(pr, reviewApp, repository, prNumber) {
+		ret = append(ret, pr)
+	}
+	return ret, nil
+}
+
+// isPROf returns true when the PR is of the ReviewApp and the pull request. A PR created by an older version has no repository, or no host.
+func isPROf(pr kubetempurav1.PR, reviewApp kubetempurav1.ReviewApp, repository string, prNumber string) bool {
+	if pr.Spec.ParentReviewApp != reviewApp.Name || pr.Spec.PRNumber != prNumber {
+		return false
 	}
+	return repository == "" || pr.Spec.Repository == "" || sameRepository(pr.Spec.Repository, repository)
 }
 
+// prName returns a unique name of a PR for the pair of the ReviewApp and the pull request.
+// A name longer than the limit of a label value is truncated, and a hash of the pair is appended to keep it unique.
 func prName(reviewAppName string, prNumber string) string {
+	name := legacyPRName(reviewAppName, prNumber)
+	if len(name) <= validation.LabelValueMaxLength {
+		return name
+	}
+	suffix := "-pr" + prNumber + "-" + shortHash(reviewAppName+"/"+prNumber)
+	prefix := strings.TrimRight(reviewAppName[:validation.LabelValueMaxLength-len(suffix)], "-.")
+	return prefix + suffix
+}
+
+// legacyPRName returns the name of a PR created by an older version, which has no limit of the length.
+func legacyPRName(reviewAppName string, prNumber string) string {
 	return reviewAppName + "-pr" + prNumber
 }
 
-func generatePRStruct(reviewApp kubetempurav1.ReviewApp, prNumber string, sha string) kubetempurav1.PR {
+// labelValue shortens the value with a hash when it exceeds the limit of a label value.
+func labelValue(value string) string {
+	if len(value) <= validation.LabelValueMaxLength {
+		return value
+	}
+	suffix := "-" + shortHash(value)
+	return strings.TrimRight(value[:validation.LabelValueMaxLength-len(suffix)], "-.") + suffix
+}
+
+func shortHash(value string) string {
+	h := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(h[:])[:8]
+}
+
+func generatePRStruct(reviewApp kubetempurav1.ReviewApp, pullRequest pullRequest) kubetempurav1.PR {
+	name := prName(reviewApp.Name, pullRequest.number)
+	if hasManyRepositories(reviewApp) {
+		// The hash keeps the names unique. E.g. a/b-c and a-b/c, or the same repository on GitHub and GitLab
+		name = prName(reviewApp.Name+"-"+shortHash(pullRequest.repositoryID()), pullRequest.number)
+	}
+	envVars, vars, err := parseDescription(pullRequest.description)
+	if err != nil {
+		// The review app is deployed without the settings rather than left outdated.
+		log.Info("Ignored the settings in the description", "reason", err.Error(), "reviewApp", reviewApp.Name, "prNumber", pullRequest.number)
+	}
 	return kubetempurav1.PR{
 		TypeMeta: metav1.TypeMeta{
 			APIVersion: "kubetempura.mercari.com/v1",
 			Kind:       "PR",
 		},
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      prName(reviewApp.Name, prNumber),
+			Name:      name,
 			Namespace: reviewApp.Namespace,
+			Labels: map[string]string{
+				kubetempurav1.LabelReviewApp: labelValue(reviewApp.Name),
+				kubetempurav1.LabelPRNumber:  pullRequest.number,
+			},
 		},
 		Spec: kubetempurav1.PRSpec{
-			ParentReviewApp: reviewApp.Name,
-			PRNumber:        prNumber,
-			HeadCommitRef:   sha,
-			EnvVars:         nil, // TODO: we can give environment variables with the future updates.
+			ParentReviewApp:   reviewApp.Name,
+			PRNumber:          pullRequest.number,
+			Repository:        pullRequest.repositoryID(),
+			HeadCommitRef:     pullRequest.headSHA,
+			EnvVars:           envVars,
+			Vars:              vars,
+			ScaledDown:        shouldScaleDown(reviewApp, pullRequest),
+			LastEventTime:     lastEventTime(pullRequest),
+			ApprovedCommitRef: approvedCommit(reviewApp, pullRequest),
 		},
 	}
 }
+
+// keepCommandFields copies the fields set by the commands from the existing spec, because an event of the pull request doesn't have them.
+// The approved commit is kept too unless the event approves another one.
+func keepCommandFields(spec *kubetempurav1.PRSpec, existing kubetempurav1.PRSpec) {
+	spec.CommandEnvVars = existing.CommandEnvVars
+	spec.Pinned = existing.Pinned
+	spec.RedeployRequestedAt = existing.RedeployRequestedAt
+	if spec.ApprovedCommitRef == "" {
+		spec.ApprovedCommitRef = existing.ApprovedCommitRef
+	}
+}
+
+func lastEventTime(pullRequest pullRequest) *metav1.Time {
+	if pullRequest.updatedAt.IsZero() {
+		return nil
+	}
+	t := metav1.NewTime(pullRequest.updatedAt)
+	return &t
+}
@@ -0,0 +1,512 @@
+package github
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	kubetempurav1 "github.com/mercari/kubetempura/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newFakeClient(t *testing.T, objs ...client.Object) client.Client {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	if err := kubetempurav1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	return fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()
+}
+
+func TestPRName(t *testing.T) {
+	if got := prName("web", "11"); got != "web-pr11" {
+		t.Fatalf("prName() = %v, want web-pr11", got)
+	}
+	if prName("web-pr1", "1") == prName("web", "11") {
+		t.Fatalf("prName() must be unique: %v", prName("web", "11"))
+	}
+
+	long := strings.Repeat("a", 100)
+	if got := prName(long, "12345"); len(got) > validation.LabelValueMaxLength {
+		t.Fatalf("prName() = %v, longer than %d", got, validation.LabelValueMaxLength)
+	}
+	if prName(long, "1") == prName(long+"b", "1") {
+		t.Fatalf("prName() must be unique after truncated: %v", prName(long, "1"))
+	}
+	if errs := validation.IsDNS1123Subdomain(prName(strings.Repeat("a-", 50), "1")); len(errs) != 0 {
+		t.Fatalf("prName() is invalid: %v", errs)
+	}
+}
+
+func TestLabelValue(t *testing.T) {
+	if got := labelValue("web"); got != "web" {
+		t.Fatalf("labelValue() = %v, want web", got)
+	}
+	long := strings.Repeat("a", 100)
+	if got := labelValue(long); len(validation.IsValidLabelValue(got)) != 0 {
+		t.Fatalf("labelValue() = %v, invalid", got)
+	}
+	if labelValue(long) == labelValue(long+"b") {
+		t.Fatalf("labelValue() must be unique")
+	}
+}
+
+func TestFindPRs(t *testing.T) {
+	web := kubetempurav1.ReviewApp{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"}}
+	labeled := generatePRStruct(web, pullRequest{number: "11", headSHA: "abcdefg"})
+	// Created by an older version without the labels.
+	legacy := kubetempurav1.PR{
+		ObjectMeta: metav1.ObjectMeta{Name: "web-pr1", Namespace: "default"},
+		Spec:       kubetempurav1.PRSpec{ParentReviewApp: "web", PRNumber: "1", HeadCommitRef: "abcdefg"},
+	}
+	c := newFakeClient(t, &labeled, &legacy)
+
+	tests := []struct {
+		name      string
+		reviewApp kubetempurav1.ReviewApp
+		prNumber  string
+		want      string
+	}{
+		{
+			name:      "by labels",
+			reviewApp: web,
+			prNumber:  "11",
+			want:      labeled.Name,
+		},
+		{
+			name:      "by the legacy name",
+			reviewApp: web,
+			prNumber:  "1",
+			want:      "web-pr1",
+		},
+		{
+			name:      "not found",
+			reviewApp: web,
+			prNumber:  "12",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prs, err := findPRs(context.Background(), tt.reviewApp, "", tt.prNumber, c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.want == "" {
+				if len(prs) != 0 {
+					t.Fatalf("findPRs() = %v, want nothing", prs)
+				}
+				return
+			}
+			if len(prs) != 1 || prs[0].Name != tt.want {
+				t.Fatalf("findPRs() = %v, want %v", prs, tt.want)
+			}
+		})
+	}
+}
+
+func TestPRUpdatedOutOfOrder(t *testing.T) {
+	web := &kubetempurav1.ReviewApp{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"}}
+	older := pullRequest{number: "1", headSHA: "older", updatedAt: time.Date(2021, 7, 1, 0, 0, 0, 0, time.UTC)}
+	newer := pullRequest{number: "1", headSHA: "newer", updatedAt: older.updatedAt.Add(time.Minute)}
+
+	for i := 0; i < 20; i++ {
+		c := newFakeClient(t, web)
+		// Two deliveries are processed concurrently in any order.
+		var wg sync.WaitGroup
+		for _, event := range []pullRequest{newer, older} {
+			wg.Add(1)
+			go func(event pullRequest) {
+				defer wg.Done()
+				prUpdated(context.Background(), []kubetempurav1.ReviewApp{*web}, event, c)
+			}(event)
+		}
+		wg.Wait()
+
+		prs, err := findPRs(context.Background(), *web, "", "1", c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(prs) != 1 || prs[0].Spec.HeadCommitRef != "newer" {
+			t.Fatalf("PRs = %v, want the one of the newer event", prs)
+		}
+
+		// A closed event older than the PR doesn't delete it.
+		prClosed(context.Background(), []kubetempurav1.ReviewApp{*web}, older, c)
+		if prs, err := findPRs(context.Background(), *web, "", "1", c); err != nil || len(prs) != 1 {
+			t.Fatalf("findPRs() = %v, %v, want the PR", prs, err)
+		}
+	}
+}
+
+func TestIsStale(t *testing.T) {
+	last := metav1.NewTime(time.Date(2021, 7, 1, 0, 0, 0, 0, time.UTC))
+	pr := kubetempurav1.PR{Spec: kubetempurav1.PRSpec{HeadCommitRef: "deployed", LastEventTime: &last}}
+	tests := []struct {
+		name        string
+		pullRequest pullRequest
+		want        bool
+	}{
+		{name: "older", pullRequest: pullRequest{headSHA: "deployed", updatedAt: last.Add(-time.Second)}, want: true},
+		{name: "newer", pullRequest: pullRequest{headSHA: "another", updatedAt: last.Add(time.Second)}},
+		{name: "same second with the same commit", pullRequest: pullRequest{headSHA: "deployed", updatedAt: last.Time}},
+		// Another delivery in the same second may be older.
+		{name: "same second with another commit", pullRequest: pullRequest{headSHA: "another", updatedAt: last.Time}, want: true},
+		{name: "same second with another commit from the API", pullRequest: pullRequest{headSHA: "another", updatedAt: last.Time, current: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isStale(pr, tt.pullRequest); got != tt.want {
+				t.Fatalf("isStale() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if isStale(kubetempurav1.PR{}, pullRequest{headSHA: "another"}) {
+		t.Fatal("isStale() = true, want false for a PR without the time of the event")
+	}
+}
+
+func TestPRUpdatedWithDescription(t *testing.T) {
+	web := &kubetempurav1.ReviewApp{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"}}
+	c := newFakeClient(t, web)
+	opened := pullRequest{number: "1", headSHA: "abcdefg", updatedAt: time.Date(2021, 7, 1, 0, 0, 0, 0, time.UTC),
+		description: "```kubetempura\nenv:\n  FOO: bar\nvars:\n  IMAGE_TAG: v1\n```"}
+	prUpdated(context.Background(), []kubetempurav1.ReviewApp{*web}, opened, c)
+	if err := updatePRWithRetry(context.Background(), *web, opened, c, func(spec *kubetempurav1.PRSpec) {
+		spec.CommandEnvVars = []corev1.EnvVar{{Name: "FOO", Value: "command"}}
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The edit of the description replaces the settings, and keeps the environment variables of /tempura env.
+	edited := opened
+	edited.updatedAt = opened.updatedAt.Add(time.Minute)
+	edited.description = "```kubetempura\nenv:\n  BAZ: qux\n```"
+	prUpdated(context.Background(), []kubetempurav1.ReviewApp{*web}, edited, c)
+	prs, err := findPRs(context.Background(), *web, "", "1", c)
+	if err != nil || len(prs) != 1 {
+		t.Fatalf("findPRs() = %v, %v, want the PR", prs, err)
+	}
+	spec := prs[0].Spec
+	if !reflect.DeepEqual(spec.EnvVars, []corev1.EnvVar{{Name: "BAZ", Value: "qux"}}) || spec.Vars != nil ||
+		!reflect.DeepEqual(spec.CommandEnvVars, []corev1.EnvVar{{Name: "FOO", Value: "command"}}) {
+		t.Fatalf("spec = %+v, want the settings of the edited description", spec)
+	}
+}
+
+func TestHandlePullRequestAfterClose(t *testing.T) {
+	var state atomic.Value
+	state.Store("open")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/mercari/kubetempura/pulls/1" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(`{"number": 1, "state": "` + state.Load().(string) + `", "head": {"sha": "newer"}, "updated_at": "2021-07-01T00:02:00Z"}`))
+	}))
+	defer server.Close()
+
+	web := &kubetempurav1.ReviewApp{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+		Spec:       kubetempurav1.ReviewAppSpec{GithubRepository: "https://github.com/mercari/kubetempura"},
+	}
+	c := newFakeClient(t, web)
+	p, err := newGitHubProvider(NewClient(server.URL, ""), WebhookOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handle := func(sha string, updatedAt time.Time, closed bool) {
+		t.Helper()
+		e := &pullRequestEvent{
+			repository:  "https://github.com/mercari/kubetempura",
+			pullRequest: pullRequest{number: "1", headSHA: sha, updatedAt: updatedAt, repository: "mercari/kubetempura"},
+			closed:      closed,
+		}
+		if err := handlePullRequest(context.Background(), p, e, "", c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	countPRs := func() int {
+		t.Helper()
+		prs, err := findPRs(context.Background(), *web, "", "1", c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(prs)
+	}
+
+	opened := time.Date(2021, 7, 1, 0, 0, 0, 0, time.UTC)
+	handle("older", opened, false)
+	if n := countPRs(); n != 1 {
+		t.Fatalf("PRs = %d, want the PR of the open pull request", n)
+	}
+	state.Store("closed")
+	handle("newer", opened.Add(2*time.Minute), true)
+	if n := countPRs(); n != 0 {
+		t.Fatalf("PRs = %d, want the PR deleted", n)
+	}
+
+	// The synchronize delivered after the close doesn't create the PR again.
+	handle("older", opened.Add(time.Minute), false)
+	if n := countPRs(); n != 0 {
+		t.Fatalf("PRs = %d, an old event must not create the PR of the closed pull request", n)
+	}
+}
+
+const (
+	testSecret = "secret"
+
+	openedPayload = `{"action": "opened", "number": 1, "pull_request": {"number": 1, "head": {"sha": "abcdefg"}}, "repository": {"html_url": "https://github.com/mercari/kubetempura", "full_name": "mercari/kubetempura"}}`
+)
+
+func newWebhookRequest(t *testing.T, event string, delivery string, body string, secret string) *http.Request {
+	t.Helper()
+	return newNamespaceWebhookRequest(t, "", event, delivery, body, secret)
+}
+
+func newNamespaceWebhookRequest(t *testing.T, namespace string, event string, delivery string, body string, secret string) *http.Request {
+	t.Helper()
+	target := path
+	if namespace != "" {
+		target += "/" + namespace
+	}
+	r := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+	r.Header.Set("X-GitHub-Event", event)
+	r.Header.Set("X-GitHub-Delivery", delivery)
+	if secret != "" {
+		mac := hmac.New(sha1.New, []byte(secret))
+		_, _ = mac.Write([]byte(body))
+		r.Header.Set("X-Hub-Signature", "sha1="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	return r
+}
+
+func newTestWebhookHandler(t *testing.T, c client.Client, queueSize int) *webhookHandler {
+	t.Helper()
+	p, err := newGitHubProvider(NewClient("http://localhost", ""), WebhookOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newWebhookHandler(p, c, &webhookSecrets{client: c, static: testSecret}, WebhookOptions{Workers: 1, QueueSize: queueSize, Timeout: time.Second})
+}
+
+func TestWebhookHandler(t *testing.T) {
+	tests := []struct {
+		name      string
+		queueSize int
+		request   func() *http.Request
+		wantCode  int
+		wantBody  string
+	}{
+		{
+			name:     "method not allowed",
+			request:  func() *http.Request { return httptest.NewRequest(http.MethodGet, path, nil) },
+			wantCode: http.StatusMethodNotAllowed,
+		},
+		{
+			name: "missing event",
+			request: func() *http.Request {
+				r := newWebhookRequest(t, "pull_request", "1", openedPayload, testSecret)
+				r.Header.Del("X-GitHub-Event")
+				return r
+			},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "missing signature",
+			request:  func() *http.Request { return newWebhookRequest(t, "pull_request", "1", openedPayload, "") },
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "invalid signature",
+			request:  func() *http.Request { return newWebhookRequest(t, "pull_request", "1", openedPayload, "wrong") },
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "invalid payload",
+			request:  func() *http.Request { return newWebhookRequest(t, "pull_request", "1", "{", testSecret) },
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "unsupported event",
+			request:  func() *http.Request { return newWebhookRequest(t, "push", "1", "{}", testSecret) },
+			wantCode: http.StatusOK,
+			wantBody: "Ignored the event.",
+		},
+		{
+			name:     "ping",
+			request:  func() *http.Request { return newWebhookRequest(t, "ping", "1", `{"hook_id": 1}`, testSecret) },
+			wantCode: http.StatusOK,
+			wantBody: "pong",
+		},
+		{
+			name:      "pull request",
+			queueSize: 1,
+			request:   func() *http.Request { return newWebhookRequest(t, "pull_request", "1", openedPayload, testSecret) },
+			wantCode:  http.StatusAccepted,
+			wantBody:  "Accepted",
+		},
+		{
+			name:     "queue is full",
+			request:  func() *http.Request { return newWebhookRequest(t, "pull_request", "1", openedPayload, testSecret) },
+			wantCode: http.StatusServiceUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			newTestWebhookHandler(t, newFakeClient(t), tt.queueSize).ServeHTTP(w, tt.request())
+			if w.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantCode, w.Body.String())
+			}
+			if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+				t.Fatalf("body = %q, want %q", w.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestWebhookHandlerRedelivery(t *testing.T) {
+	web := &kubetempurav1.ReviewApp{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+		Spec:       kubetempurav1.ReviewAppSpec{GithubRepository: "https://github.com/mercari/kubetempura"},
+	}
+	c := newFakeClient(t, web)
+	h := newTestWebhookHandler(t, c, 10)
+	deliver := func(delivery string) int {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, newWebhookRequest(t, "pull_request", delivery, openedPayload, testSecret))
+		for h.events.queue.Len() != 0 {
+			h.events.processNext(context.Background())
+		}
+		return w.Code
+	}
+
+	if code := deliver("delivery-1"); code != http.StatusAccepted {
+		t.Fatalf("status = %d, want %d", code, http.StatusAccepted)
+	}
+	prs, err := findPRs(context.Background(), *web, "", "1", c)
+	if err != nil || len(prs) != 1 {
+		t.Fatalf("findPRs() = %v, %v, want the PR", prs, err)
+	}
+	if err := c.Delete(context.Background(), &prs[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	if code := deliver("delivery-1"); code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", code, http.StatusOK)
+	}
+	if prs, err := findPRs(context.Background(), *web, "", "1", c); err != nil || len(prs) != 0 {
+		t.Fatalf("findPRs() = %v, %v, the redelivery must be ignored", prs, err)
+	}
+
+	// A delivery which failed all the retries can be redelivered.
+	h.events.giveUp(&event{delivery: "delivery-1"})
+	if code := deliver("delivery-1"); code != http.StatusAccepted {
+		t.Fatalf("status = %d, want %d", code, http.StatusAccepted)
+	}
+	if prs, err := findPRs(context.Background(), *web, "", "1", c); err != nil || len(prs) != 1 {
+		t.Fatalf("findPRs() = %v, %v, the redelivery must be handled", prs, err)
+	}
+}
+
+func TestWebhookHandlerNamespace(t *testing.T) {
+	newReviewApp := func(namespace string, secretRef *corev1.LocalObjectReference) *kubetempurav1.ReviewApp {
+		return &kubetempurav1.ReviewApp{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: namespace},
+			Spec: kubetempurav1.ReviewAppSpec{
+				GithubRepository: "https://github.com/mercari/kubetempura",
+				WebhookSecretRef: secretRef,
+			},
+		}
+	}
+	teamA := newReviewApp("team-a", &corev1.LocalObjectReference{Name: "webhook"})
+	teamB := newReviewApp("team-b", nil)
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "webhook", Namespace: "team-a"},
+		Data:       map[string][]byte{"secret": []byte("team-a-secret")},
+	}
+	c := newFakeClient(t, teamA, teamB, secret)
+	h := newTestWebhookHandler(t, c, 10)
+
+	tests := []struct {
+		name      string
+		namespace string
+		secret    string
+		wantCode  int
+	}{
+		{name: "signed with the secret of the namespace", namespace: "team-a", secret: "team-a-secret", wantCode: http.StatusAccepted},
+		{name: "signed with the shared secret", namespace: "team-a", secret: testSecret, wantCode: http.StatusUnauthorized},
+		{name: "namespace without a secret", namespace: "team-b", secret: testSecret, wantCode: http.StatusNotFound},
+		{name: "invalid namespace", namespace: "team-a/web", secret: "team-a-secret", wantCode: http.StatusNotFound},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, newNamespaceWebhookRequest(t, tt.namespace, "pull_request", strconv.Itoa(i), openedPayload, tt.secret))
+			if w.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantCode, w.Body.String())
+			}
+		})
+	}
+
+	for h.events.queue.Len() != 0 {
+		h.events.processNext(context.Background())
+	}
+	if prs, err := findPRs(context.Background(), *teamA, "", "1", c); err != nil || len(prs) != 1 {
+		t.Fatalf("findPRs() = %v, %v, want the PR in the namespace", prs, err)
+	}
+	if prs, err := findPRs(context.Background(), *teamB, "", "1", c); err != nil || len(prs) != 0 {
+		t.Fatalf("findPRs() = %v, %v, the other namespace must not receive the event", prs, err)
+	}
+}
+
+func TestWebhookHandlerSharedEndpoint(t *testing.T) {
+	newReviewApp := func(namespace string, secretRef *corev1.LocalObjectReference) *kubetempurav1.ReviewApp {
+		return &kubetempurav1.ReviewApp{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: namespace},
+			Spec: kubetempurav1.ReviewAppSpec{
+				GithubRepository: "https://github.com/mercari/kubetempura",
+				WebhookSecretRef: secretRef,
+			},
+		}
+	}
+	teamA := newReviewApp("team-a", &corev1.LocalObjectReference{Name: "webhook"})
+	teamB := newReviewApp("team-b", nil)
+	c := newFakeClient(t, teamA, teamB)
+	h := newTestWebhookHandler(t, c, 10)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, newWebhookRequest(t, "pull_request", "delivery-1", openedPayload, testSecret))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusAccepted, w.Body.String())
+	}
+	for h.events.queue.Len() != 0 {
+		h.events.processNext(context.Background())
+	}
+	if prs, err := findPRs(context.Background(), *teamA, "", "1", c); err != nil || len(prs) != 0 {
+		t.Fatalf("findPRs() = %v, %v, a ReviewApp with its own endpoint must not receive the event of the shared one", prs, err)
+	}
+	if prs, err := findPRs(context.Background(), *teamB, "", "1", c); err != nil || len(prs) != 1 {
+		t.Fatalf("findPRs() = %v, %v, want the PR of the ReviewApp without its own endpoint", prs, err)
+	}
+}
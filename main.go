@@ -17,15 +17,18 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"flag"
 	"os"
-	"sync"
+	"strings"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -55,12 +58,38 @@ func main() {
 	var enableLeaderElection bool
 	var probeAddr string
 	var githubWebhookSecret string
+	var githubWebhookSecretRef string
+	var githubAPIURL string
+	var githubToken string
+	var githubResyncInterval time.Duration
+	var webhookProviders string
+	var gitlabWebhookSecret, gitlabWebhookSecretRef string
+	var giteaWebhookSecret, giteaWebhookSecretRef string
+	var webhookOptions github.WebhookOptions
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
 	flag.StringVar(&githubWebhookSecret, "github-webhook-secret", "", "The secret token for the GitHub Webhooks.")
+	flag.StringVar(&githubWebhookSecretRef, "github-webhook-secret-ref", "", "The Secret which has the secret tokens for the GitHub Webhooks as NAMESPACE/NAME. Each value of the Secret is accepted, and a change of it takes effect without a restart.")
+	flag.StringVar(&githubAPIURL, "github-api-url", github.DefaultAPIURL, "The URL of the GitHub REST API. E.g. https://HOSTNAME/api/v3/ for GitHub Enterprise Server.")
+	flag.StringVar(&githubToken, "github-token", os.Getenv("GITHUB_TOKEN"), "The token for the GitHub REST API. It's required to read private repositories. Defaults to $GITHUB_TOKEN.")
+	flag.DurationVar(&githubResyncInterval, "github-resync-interval", 10*time.Minute, "The interval to resync the PRs with the open pull requests on GitHub. 0 disables the resync.")
+	flag.StringVar(&webhookOptions.BindAddress, "webhook-bind-address", ":3000", "The address the GitHub Webhooks endpoint binds to.")
+	flag.StringVar(&webhookOptions.CertFile, "webhook-tls-cert-file", "", "The TLS certificate file of the GitHub Webhooks endpoint. It serves HTTP when it's empty.")
+	flag.StringVar(&webhookOptions.KeyFile, "webhook-tls-key-file", "", "The TLS key file of the GitHub Webhooks endpoint.")
+	flag.DurationVar(&webhookOptions.ReadTimeout, "webhook-read-timeout", 10*time.Second, "The timeout to read a request of the GitHub Webhooks.")
+	flag.DurationVar(&webhookOptions.WriteTimeout, "webhook-write-timeout", 10*time.Second, "The timeout to write a response of the GitHub Webhooks.")
+	flag.IntVar(&webhookOptions.Workers, "webhook-workers", 4, "The number of the webhook events processed at the same time.")
+	flag.IntVar(&webhookOptions.QueueSize, "webhook-queue-size", 100, "The number of the webhook events waiting to be processed. A webhook is rejected when the queue is full.")
+	flag.DurationVar(&webhookOptions.Timeout, "webhook-event-timeout", 30*time.Second, "The time limit of each try of a webhook event. A failed event is retried with a backoff.")
+	flag.StringVar(&webhookProviders, "webhook-providers", "github", "The comma-separated providers which the webhooks are accepted from. Supported: "+strings.Join(github.ProviderNames(), ", ")+".")
+	flag.StringVar(&gitlabWebhookSecret, "gitlab-webhook-secret", "", "The secret token for the GitLab Webhooks. The webhooks of GitLab are rejected without it or --gitlab-webhook-secret-ref.")
+	flag.StringVar(&gitlabWebhookSecretRef, "gitlab-webhook-secret-ref", "", "The Secret which has the secret tokens for the GitLab Webhooks as NAMESPACE/NAME.")
+	flag.StringVar(&giteaWebhookSecret, "gitea-webhook-secret", "", "The secret for the Gitea Webhooks.")
+	flag.StringVar(&giteaWebhookSecretRef, "gitea-webhook-secret-ref", "", "The Secret which has the secrets for the Gitea Webhooks as NAMESPACE/NAME.")
+	flag.BoolVar(&webhookOptions.ReportStatus, "github-report-status", false, "Create a commit status of each review app on the head commit of the pull request. It requires --github-token with the permission to write the statuses.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -69,6 +98,17 @@ func main() {
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
+	webhookOptions.SecretRef = parseSecretRef("github-webhook-secret-ref", githubWebhookSecretRef)
+	webhookOptions.ProviderSecrets = map[string]github.ProviderSecret{
+		"gitlab": {Secret: gitlabWebhookSecret, SecretRef: parseSecretRef("gitlab-webhook-secret-ref", gitlabWebhookSecretRef)},
+		"gitea":  {Secret: giteaWebhookSecret, SecretRef: parseSecretRef("gitea-webhook-secret-ref", giteaWebhookSecretRef)},
+	}
+	for _, provider := range strings.Split(webhookProviders, ",") {
+		if provider = strings.TrimSpace(provider); provider != "" {
+			webhookOptions.Providers = append(webhookOptions.Providers, provider)
+		}
+	}
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:                 scheme,
 		MetricsBindAddress:     metricsAddr,
@@ -90,14 +130,42 @@ func main() {
 		os.Exit(1)
 	}
 	if err = (&controllers.PRReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:    mgr.GetClient(),
+		Scheme:    mgr.GetScheme(),
+		APIReader: mgr.GetAPIReader(),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "PR")
 		os.Exit(1)
 	}
 	//+kubebuilder:scaffold:builder
 
+	gh := github.NewClient(githubAPIURL, githubToken)
+	if githubResyncInterval > 0 {
+		if err := mgr.Add(&github.Resyncer{
+			Client:   mgr.GetClient(),
+			GitHub:   gh,
+			Interval: githubResyncInterval,
+		}); err != nil {
+			setupLog.Error(err, "unable to set up the resync with GitHub")
+			os.Exit(1)
+		}
+	}
+
+	if err := github.IndexReviewApps(context.Background(), mgr.GetFieldIndexer()); err != nil {
+		setupLog.Error(err, "unable to index the ReviewApps by the repositories")
+		os.Exit(1)
+	}
+	webhookOptions.APIReader = mgr.GetAPIReader()
+	webhookServer, err := github.NewWebhookServer(mgr.GetClient(), githubWebhookSecret, gh, webhookOptions)
+	if err != nil {
+		setupLog.Error(err, "unable to set up the GitHub Webhooks")
+		os.Exit(1)
+	}
+	if err := mgr.Add(webhookServer); err != nil {
+		setupLog.Error(err, "unable to set up the GitHub Webhooks")
+		os.Exit(1)
+	}
+
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to set up health check")
 		os.Exit(1)
@@ -106,23 +174,27 @@ func main() {
 		setupLog.Error(err, "unable to set up ready check")
 		os.Exit(1)
 	}
+	if err := mgr.AddReadyzCheck("webhooks", webhookServer.ReadyCheck); err != nil {
+		setupLog.Error(err, "unable to set up ready check")
+		os.Exit(1)
+	}
 
-	wg := new(sync.WaitGroup)
-	wg.Add(2)
-
-	go func() {
-		setupLog.Info("starting manager")
-		if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
-			setupLog.Error(err, "problem running manager")
-			os.Exit(1)
-		}
-		wg.Done()
-	}()
-
-	go func() {
-		github.Webhooks(mgr.GetClient(), githubWebhookSecret)
-		wg.Done()
-	}()
+	setupLog.Info("starting manager")
+	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
+		setupLog.Error(err, "problem running manager")
+		os.Exit(1)
+	}
+}
 
-	wg.Wait()
+// parseSecretRef returns the Secret of the flag in the form of NAMESPACE/NAME. It exits when the value is invalid.
+func parseSecretRef(name string, value string) types.NamespacedName {
+	if value == "" {
+		return types.NamespacedName{}
+	}
+	ref := strings.SplitN(value, "/", 2)
+	if len(ref) != 2 || ref[0] == "" || ref[1] == "" {
+		setupLog.Error(nil, "invalid --"+name+", it must be NAMESPACE/NAME", "value", value)
+		os.Exit(1)
+	}
+	return types.NamespacedName{Namespace: ref[0], Name: ref[1]}
 }